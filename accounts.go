@@ -0,0 +1,191 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Account is a logged in session, AuthToken and CSRFToken are the values of the auth_token and ct0 cookies
+type Account struct {
+	AuthToken string
+	CSRFToken string
+}
+
+// AccountFromCookies returns the account of the auth_token and ct0 cookies, e.g. read by ReadCookiesTxt
+func AccountFromCookies(cookies []*http.Cookie) (Account, error) {
+	var account Account
+	for _, cookie := range cookies {
+		switch cookie.Name {
+		case "auth_token":
+			account.AuthToken = cookie.Value
+		case "ct0":
+			account.CSRFToken = cookie.Value
+		}
+	}
+	if account.AuthToken == "" || account.CSRFToken == "" {
+		return account, errors.New("auth_token and ct0 cookies are not found")
+	}
+	return account, nil
+}
+
+// WithAccounts sends the requests with the accounts, rotating them by rotation.
+// The session given by WithSession or WithCookies is used as the first account.
+// An account whose session is rejected is not used anymore while other accounts are available.
+func WithAccounts(accounts []Account, rotation Rotation) ClientOption {
+	return func(c *Client) {
+		c.accounts = &accountPool{
+			accounts: accounts,
+			rotation: rotation,
+		}
+	}
+}
+
+type accountPool struct {
+	mu       sync.Mutex
+	accounts []Account
+	disabled []bool
+	rotation Rotation
+	current  int
+}
+
+// next returns the account to use and its index
+func (p *accountPool) next() (int, Account) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.current
+	if p.rotation == RotatePerRequest {
+		p.current = p.nextEnabled(p.current)
+	}
+	return i, p.accounts[i]
+}
+
+// nextEnabled returns the index of the next account not disabled, or i if there is none
+func (p *accountPool) nextEnabled(i int) int {
+	for n := 1; n < len(p.accounts); n++ {
+		j := (i + n) % len(p.accounts)
+		if !p.disabled[j] {
+			return j
+		}
+	}
+	return i
+}
+
+// rotateOnRateLimit switches to the next account, and reports whether the request should be retried with it
+func (p *accountPool) rotateOnRateLimit() bool {
+	if p == nil || p.rotation != RotateOnRateLimit {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := p.nextEnabled(p.current)
+	if next == p.current {
+		return false
+	}
+	p.current = next
+	return true
+}
+
+// disable stops using the account, and reports whether the request should be retried with another account
+func (p *accountPool) disable(i int) bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := p.nextEnabled(i)
+	if next == i {
+		// the last account is kept, so that the error is returned to the caller
+		return false
+	}
+	p.disabled[i] = true
+	if p.current == i {
+		p.current = next
+	}
+	return true
+}
+
+func (p *accountPool) size() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.accounts)
+}
+
+func (c *Client) applyAccounts() error {
+	if c.accounts == nil {
+		return nil
+	}
+	if c.authToken != "" {
+		session := Account{AuthToken: c.authToken, CSRFToken: c.csrfToken}
+		c.accounts.accounts = append([]Account{session}, c.accounts.accounts...)
+	}
+	if len(c.accounts.accounts) == 0 {
+		return errors.New("no accounts")
+	}
+	for _, a := range c.accounts.accounts {
+		if a.AuthToken == "" || a.CSRFToken == "" {
+			return errors.New("both auth_token and ct0 are required for an account")
+		}
+	}
+	c.accounts.disabled = make([]bool, len(c.accounts.accounts))
+	return nil
+}
+
+// session returns the account used for the request and its index in the pool, or -1 if it is not from the pool
+func (c *Client) session() (Account, int, bool) {
+	if c.accounts != nil {
+		i, account := c.accounts.next()
+		return account, i, true
+	}
+	if c.authToken != "" {
+		return Account{AuthToken: c.authToken, CSRFToken: c.csrfToken}, -1, true
+	}
+	return Account{}, -1, false
+}
+
+// setSession sets the credentials of the request, replacing the ones set by the previous attempt
+func (c *Client) setSession(req *http.Request) int {
+	for _, key := range []string{"Cookie", "X-Csrf-Token", "X-Twitter-Auth-Type", "X-Twitter-Active-User", "X-Guest-Token"} {
+		req.Header.Del(key)
+	}
+
+	// credentials must not be sent to other hosts such as the js cdn
+	if !c.isSessionHost(req.URL.Hostname()) {
+		return -1
+	}
+
+	account, index, ok := c.session()
+	if !ok {
+		if token := c.guestToken(); token != "" {
+			req.Header.Set("X-Guest-Token", token)
+		}
+		return -1
+	}
+
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: account.AuthToken})
+	req.AddCookie(&http.Cookie{Name: "ct0", Value: account.CSRFToken})
+	req.Header.Set("X-Csrf-Token", account.CSRFToken)
+	req.Header.Set("X-Twitter-Auth-Type", "OAuth2Session")
+	req.Header.Set("X-Twitter-Active-User", "yes")
+	return index
+}
@@ -0,0 +1,232 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// chunks scanned at most when the bearer token or the operations are not found in the known bundles
+	maxScannedChunks = 100
+)
+
+var (
+	mainJSRegexp      = regexp.MustCompile(`"(https://[^"]*?/main.[a-z0-9]+.js)"`)
+	mainJSLooseRegexp = regexp.MustCompile(`(https://abs\.twimg\.com/responsive-web/client-web[a-z-]*/main\.[a-zA-Z0-9_-]+\.js)`)
+
+	apiSuffixRegexp       = regexp.MustCompile(`api:"([a-z0-9]+)"`)
+	apiSuffixQuotedRegexp = regexp.MustCompile(`"api":"([a-z0-9]+)"`)
+
+	bearerRegexp      = regexp.MustCompile(`"(A{10,}[a-zA-Z0-9%]{30,})"`)
+	bearerLooseRegexp = regexp.MustCompile(`Bearer (A{10,}[a-zA-Z0-9%]{30,})`)
+
+	// entries of the webpack chunk map in the index, name:"hash" or "name":"hash"
+	chunkRegexp = regexp.MustCompile(`"?([a-zA-Z0-9_.~-]+)"?:"([a-f0-9]{7,8})"`)
+
+	errNoMatch = errors.New("no match")
+)
+
+// bundleStrategy is a way to find something in the bundles, run stores the result when it succeeds
+type bundleStrategy struct {
+	name string
+	run  func() error
+}
+
+// tryStrategies runs the strategies in order until one succeeds, and logs which one it was
+func (c *Client) tryStrategies(what string, strategies []bundleStrategy) error {
+	var failures []string
+	for _, s := range strategies {
+		err := s.run()
+		if err == nil {
+			c.print("%s found by %s", what, s.name)
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", s.name, err))
+	}
+	return fmt.Errorf("%s not found (%s)", what, strings.Join(failures, ", "))
+}
+
+func (c *Client) findMainJsURL(ctx context.Context, index []byte) (string, error) {
+	var mainJsURL string
+	err := c.tryStrategies("main js", []bundleStrategy{
+		{"index", func() (err error) {
+			mainJsURL, err = matchFirst(mainJSRegexp, index)
+			return err
+		}},
+		{"index loose match", func() (err error) {
+			mainJsURL, err = matchFirst(mainJSLooseRegexp, index)
+			return err
+		}},
+		{"service worker", func() error {
+			sw, err := c.fetchBundle(ctx, c.endpoints.ServiceWorker)
+			if err != nil {
+				return err
+			}
+			mainJsURL, err = matchFirst(mainJSLooseRegexp, sw)
+			return err
+		}},
+	})
+	return mainJsURL, err
+}
+
+func (c *Client) findBearerToken(ctx context.Context, mainJs []byte, chunks []string) (string, error) {
+	var token string
+	err := c.tryStrategies("bearer token", []bundleStrategy{
+		{"main js", func() (err error) {
+			token, err = matchFirst(bearerRegexp, mainJs)
+			return err
+		}},
+		{"main js loose match", func() (err error) {
+			token, err = matchFirst(bearerLooseRegexp, mainJs)
+			return err
+		}},
+		{"chunk scan", func() error {
+			return c.scanChunks(ctx, chunks, func(js []byte) bool {
+				t, err := matchFirst(bearerRegexp, js)
+				if err != nil {
+					t, err = matchFirst(bearerLooseRegexp, js)
+				}
+				token = t
+				return err == nil
+			})
+		}},
+	})
+	return token, err
+}
+
+func (c *Client) findOperations(ctx context.Context, mainJsURL string, index, mainJs []byte, chunks []string) (map[string]*Operation, error) {
+	var operations map[string]*Operation
+	fromAPIJs := func(re *regexp.Regexp) func() error {
+		return func() error {
+			suffix, err := matchFirst(re, index)
+			if err != nil {
+				return err
+			}
+			apiJsURL, err := replaceURLFile(mainJsURL, "api."+suffix+"a.js")
+			if err != nil {
+				return err
+			}
+			if operations, err = c.getOperations(ctx, apiJsURL); err != nil {
+				return err
+			}
+			c.print("api js: %v", apiJsURL)
+			c.apiJsURL = apiJsURL
+			return nil
+		}
+	}
+
+	err := c.tryStrategies("operations", []bundleStrategy{
+		{"api js", fromAPIJs(apiSuffixRegexp)},
+		{"api js quoted name", fromAPIJs(apiSuffixQuotedRegexp)},
+		{"main js", func() error {
+			operations = extractOperations(string(mainJs))
+			if len(operations) == 0 {
+				return errNoMatch
+			}
+			return nil
+		}},
+		{"chunk scan", func() error {
+			operations = make(map[string]*Operation)
+			// all chunks are scanned since the operations are split across them
+			err := c.scanChunks(ctx, chunks, func(js []byte) bool {
+				for name, op := range extractOperations(string(js)) {
+					operations[name] = op
+				}
+				return false
+			})
+			if len(operations) == 0 {
+				if err == nil {
+					err = errNoMatch
+				}
+				return err
+			}
+			return nil
+		}},
+	})
+	return operations, err
+}
+
+// chunkURLs returns the urls of the chunks listed in the webpack chunk map of the index
+func chunkURLs(mainJsURL string, index []byte) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, m := range chunkRegexp.FindAllSubmatch(index, -1) {
+		u, err := replaceURLFile(mainJsURL, string(m[1])+"."+string(m[2])+"a.js")
+		if err != nil || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// scanChunks downloads the chunks until found returns true, chunks which cannot be downloaded are skipped
+func (c *Client) scanChunks(ctx context.Context, chunks []string, found func(js []byte) bool) error {
+	if len(chunks) == 0 {
+		return errors.New("chunk map not found")
+	}
+	for i, u := range chunks {
+		if i >= maxScannedChunks {
+			break
+		}
+		js, err := c.fetchBundle(ctx, u)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		if found(js) {
+			c.print("found in chunk: %v", u)
+			return nil
+		}
+	}
+	return errNoMatch
+}
+
+func (c *Client) fetchBundle(ctx context.Context, u string) ([]byte, error) {
+	resp, err := c.get(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func matchFirst(re *regexp.Regexp, b []byte) (string, error) {
+	m := re.FindSubmatch(b)
+	if len(m) != 2 {
+		return "", errNoMatch
+	}
+	return string(m[1]), nil
+}
@@ -0,0 +1,127 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	ChatBodyTypeCaption = 45
+)
+
+const (
+	CaptionMaxDuration = 5 * time.Second
+)
+
+type Caption struct {
+	Time     time.Time
+	Username string
+	Name     string
+	Text     string
+}
+
+// CaptionCue is a caption positioned relative to the start of the recording
+type CaptionCue struct {
+	Start    time.Duration
+	End      time.Duration
+	Username string
+	Name     string
+	Text     string
+}
+
+// GetCaptions fetches the caption track of the space's media key from its chat history
+func (c *Client) GetCaptions(mediaKey string) ([]Caption, error) {
+	return c.GetCaptionsContext(context.Background(), mediaKey)
+}
+
+func (c *Client) GetCaptionsContext(ctx context.Context, mediaKey string) ([]Caption, error) {
+	stream, err := c.GetLiveVideoStreamContext(ctx, mediaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := c.AccessChatContext(ctx, stream.ChatToken)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := c.GetChatHistoryContext(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+
+	return ExtractCaptions(messages), nil
+}
+
+func ExtractCaptions(messages []ChatMessage) []Caption {
+	var captions []Caption
+	for _, m := range messages {
+		payload, body, err := m.Decode()
+		if err != nil || body.Type != ChatBodyTypeCaption || !body.Final {
+			continue
+		}
+
+		ts := body.Timestamp
+		if ts == 0 {
+			ts = payload.Timestamp / int64(time.Millisecond)
+		}
+
+		captions = append(captions, Caption{
+			Time:     time.Unix(ts/1000, ts%1000*int64(time.Millisecond)),
+			Username: body.Username,
+			Name:     body.DisplayName,
+			Text:     body.Body,
+		})
+	}
+
+	sort.SliceStable(captions, func(i, j int) bool {
+		return captions[i].Time.Before(captions[j].Time)
+	})
+
+	return captions
+}
+
+// CaptionCues converts captions to cues relative to base.
+// Each cue ends at the next caption, and lasts at most CaptionMaxDuration.
+func CaptionCues(captions []Caption, base time.Time) []CaptionCue {
+	var cues []CaptionCue
+	for i, c := range captions {
+		start := c.Time.Sub(base)
+		if start < 0 {
+			continue
+		}
+
+		end := start + CaptionMaxDuration
+		if i+1 < len(captions) {
+			if next := captions[i+1].Time.Sub(base); next > start && next < end {
+				end = next
+			}
+		}
+
+		cues = append(cues, CaptionCue{
+			Start:    start,
+			End:      end,
+			Username: c.Username,
+			Name:     c.Name,
+			Text:     c.Text,
+		})
+	}
+	return cues
+}
@@ -0,0 +1,220 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type interaction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+type Cassette struct {
+	transport   http.RoundTripper
+	replay      bool
+	ignoreQuery bool
+
+	mu           sync.Mutex
+	file         *os.File
+	interactions map[string][]*interaction
+}
+
+func NewRecordingCassette(file string, transport http.RoundTripper) (*Cassette, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if transport == nil {
+		transport = defaultTransport()
+	}
+
+	return &Cassette{
+		transport: transport,
+		file:      f,
+	}, nil
+}
+
+// NewReplayCassette returns an empty replaying cassette, responses are added by AddResponse.
+// If ignoreQuery is true, responses are matched without the query string of the urls.
+func NewReplayCassette(ignoreQuery bool) *Cassette {
+	return &Cassette{
+		replay:       true,
+		ignoreQuery:  ignoreQuery,
+		interactions: make(map[string][]*interaction),
+	}
+}
+
+// AddResponse adds a response replayed for the request of method and url
+func (c *Cassette) AddResponse(method, url string, statusCode int, header http.Header, body []byte) {
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.key(method, url)
+	c.interactions[key] = append(c.interactions[key], &interaction{
+		Method:     method,
+		URL:        url,
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       body,
+	})
+}
+
+func LoadCassette(file string) (*Cassette, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &Cassette{
+		replay:       true,
+		interactions: make(map[string][]*interaction),
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var i interaction
+			if err := json.Unmarshal(line, &i); err != nil {
+				return nil, err
+			}
+			key := c.key(i.Method, i.URL)
+			c.interactions[key] = append(c.interactions[key], &i)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Cassette) Replaying() bool {
+	return c.replay
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.replay {
+		return c.replayResponse(req)
+	}
+	return c.recordResponse(req)
+}
+
+func (c *Cassette) Close() error {
+	if c.file != nil {
+		return c.file.Close()
+	}
+	return nil
+}
+
+func (c *Cassette) recordResponse(req *http.Request) (*http.Response, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(&interaction{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	_, err = c.file.Write(append(b, '\n'))
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (c *Cassette) replayResponse(req *http.Request) (*http.Response, error) {
+	key := c.key(req.Method, req.URL.String())
+
+	c.mu.Lock()
+	queue := c.interactions[key]
+	if len(queue) == 0 {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cassette: no recorded response for %s", key)
+	}
+	// repeat the last response once the recorded ones are used up
+	i := queue[0]
+	if len(queue) > 1 {
+		c.interactions[key] = queue[1:]
+	}
+	c.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.StatusCode, http.StatusText(i.StatusCode)),
+		StatusCode:    i.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(i.Body)),
+		ContentLength: int64(len(i.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (c *Cassette) key(method, u string) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	if c.ignoreQuery {
+		if i := strings.IndexByte(u, '?'); i >= 0 {
+			u = u[:i]
+		}
+	}
+	return strings.ToUpper(method) + " " + u
+}
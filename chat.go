@@ -0,0 +1,166 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const (
+	accessChatPublicURL = "https://proxsee.pscp.tv/api/v2/accessChatPublic"
+	chatHistoryLimit    = 1000
+)
+
+const (
+	ChatBodyTypeText = 1
+)
+
+type ChatAccess struct {
+	AccessToken string `json:"access_token"`
+	Endpoint    string `json:"endpoint"`
+	RoomID      string `json:"room_id"`
+}
+
+type ChatMessage struct {
+	Kind      int    `json:"kind"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type ChatPayload struct {
+	Room      string `json:"room"`
+	Body      string `json:"body"`
+	Lang      string `json:"lang"`
+	Timestamp int64  `json:"timestamp"`
+	UUID      string `json:"uuid"`
+	Sender    struct {
+		UserID      string `json:"user_id"`
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	} `json:"sender"`
+}
+
+type ChatBody struct {
+	Type        int    `json:"type"`
+	Body        string `json:"body"`
+	Final       bool   `json:"final"`
+	Timestamp   int64  `json:"timestamp"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	RemoteID    string `json:"remoteID"`
+	UUID        string `json:"uuid"`
+}
+
+func (m *ChatMessage) Decode() (*ChatPayload, *ChatBody, error) {
+	var payload ChatPayload
+	if err := json.Unmarshal([]byte(m.Payload), &payload); err != nil {
+		return nil, nil, err
+	}
+
+	var body ChatBody
+	if err := json.Unmarshal([]byte(payload.Body), &body); err != nil {
+		return &payload, nil, err
+	}
+
+	return &payload, &body, nil
+}
+
+func (c *Client) AccessChat(chatToken string) (*ChatAccess, error) {
+	return c.AccessChatContext(context.Background(), chatToken)
+}
+
+func (c *Client) AccessChatContext(ctx context.Context, chatToken string) (*ChatAccess, error) {
+	var access ChatAccess
+	if err := c.postJSON(ctx, accessChatPublicURL, map[string]interface{}{"chat_token": chatToken}, &access); err != nil {
+		return nil, err
+	}
+	if access.Endpoint == "" || access.AccessToken == "" {
+		return nil, errors.New("chat access not granted")
+	}
+	return &access, nil
+}
+
+func (c *Client) GetChatHistory(access *ChatAccess) ([]ChatMessage, error) {
+	return c.GetChatHistoryContext(context.Background(), access)
+}
+
+func (c *Client) GetChatHistoryContext(ctx context.Context, access *ChatAccess) ([]ChatMessage, error) {
+	type historyResponse struct {
+		Messages []ChatMessage `json:"messages"`
+		Cursor   string        `json:"cursor"`
+	}
+
+	var messages []ChatMessage
+	cursor := ""
+	for {
+		req := map[string]interface{}{
+			"access_token": access.AccessToken,
+			"cursor":       cursor,
+			"limit":        chatHistoryLimit,
+			"since":        nil,
+			"quick_get":    true,
+		}
+
+		var resp historyResponse
+		if err := c.postJSON(ctx, access.Endpoint+"/chatapi/v1/history", req, &resp); err != nil {
+			return nil, err
+		}
+		messages = append(messages, resp.Messages...)
+
+		if resp.Cursor == "" || len(resp.Messages) == 0 {
+			break
+		}
+		cursor = resp.Cursor
+	}
+
+	return messages, nil
+}
+
+func (c *Client) postJSON(ctx context.Context, url string, in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,83 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetChatHistoryPaging(t *testing.T) {
+	pages := map[string]string{"": "c1", "c1": "c2", "c2": ""}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AccessToken string `json:"access_token"`
+			Cursor      string `json:"cursor"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AccessToken != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next, ok := pages[req.Cursor]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"messages":[{"kind":1,"payload":"%s"}],"cursor":"%s"}`, req.Cursor, next)
+	}))
+	defer server.Close()
+
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := c.GetChatHistory(&ChatAccess{AccessToken: "token", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("messages = %d, want 3", len(messages))
+	}
+	for i, want := range []string{"", "c1", "c2"} {
+		if messages[i].Payload != want {
+			t.Errorf("messages[%d] = %q, want %q", i, messages[i].Payload, want)
+		}
+	}
+}
+
+func TestGetChatHistoryStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetChatHistory(&ChatAccess{AccessToken: "token", Endpoint: server.URL})
+	var qe *QueryError
+	if !errors.As(err, &qe) || qe.StatusCode != http.StatusForbidden {
+		t.Fatalf("err = %v, want QueryError with status 403", err)
+	}
+}
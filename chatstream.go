@@ -0,0 +1,313 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	chatMessageKindChat    = 1
+	chatMessageKindControl = 2
+	chatMessageKindAuth    = 3
+
+	chatControlKindJoin = 1
+
+	chatControlKindPresenceJoin  = 1
+	chatControlKindPresenceLeave = 2
+
+	ChatBodyTypeReaction = 2
+)
+
+type ChatEventType int
+
+const (
+	ChatEventUnknown ChatEventType = iota
+	ChatEventChat
+	ChatEventReaction
+	ChatEventCaption
+	ChatEventJoin
+	ChatEventLeave
+)
+
+func (t ChatEventType) String() string {
+	switch t {
+	case ChatEventChat:
+		return "chat"
+	case ChatEventReaction:
+		return "reaction"
+	case ChatEventCaption:
+		return "caption"
+	case ChatEventJoin:
+		return "join"
+	case ChatEventLeave:
+		return "leave"
+	default:
+		return "unknown"
+	}
+}
+
+// ChatEvent is a message received from the live chat.
+// Text holds the chat text, the reaction emoji or the caption text depending on Type.
+type ChatEvent struct {
+	Type        ChatEventType
+	Time        time.Time
+	UserID      string
+	Username    string
+	DisplayName string
+	Text        string
+	Final       bool
+	Raw         ChatMessage
+}
+
+type ChatConn struct {
+	ws     *wsConn
+	roomID string
+	stop   func()
+}
+
+// ConnectChat connects to the live chat of the space and joins its room
+func (c *Client) ConnectChat(access *ChatAccess) (*ChatConn, error) {
+	return c.ConnectChatContext(context.Background(), access)
+}
+
+func (c *Client) ConnectChatContext(ctx context.Context, access *ChatAccess) (*ChatConn, error) {
+	if access == nil || access.Endpoint == "" || access.AccessToken == "" {
+		return nil, errors.New("chat access is not available")
+	}
+
+	url := strings.TrimSuffix(access.Endpoint, "/") + "/chatapi/v1/chatnow"
+
+	header := http.Header{}
+	if c.userAgent != "" {
+		header.Set("User-Agent", c.userAgent)
+	}
+
+	ws, err := dialWebSocket(ctx, c.client, url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &ChatConn{
+		ws:     ws,
+		roomID: access.RoomID,
+	}
+	// closing the connection unblocks a pending read when the context is cancelled
+	conn.stop = afterFunc(ctx, func() { ws.rwc.Close() })
+
+	auth, err := json.Marshal(map[string]interface{}{"access_token": access.AccessToken})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.send(chatMessageKindAuth, string(auth)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	room, err := json.Marshal(map[string]interface{}{"room": access.RoomID})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	join, err := json.Marshal(map[string]interface{}{"body": string(room), "kind": chatControlKindJoin})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.send(chatMessageKindControl, string(join)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c *ChatConn) send(kind int, payload string) error {
+	b, err := json.Marshal(map[string]interface{}{"kind": kind, "payload": payload})
+	if err != nil {
+		return err
+	}
+	return c.ws.writeText(string(b))
+}
+
+// Next blocks until the next chat event is received.
+// io.EOF is returned when the chat is closed by the server.
+func (c *ChatConn) Next() (*ChatEvent, error) {
+	for {
+		b, err := c.ws.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		var m ChatMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			continue
+		}
+
+		if ev := parseChatEvent(m); ev != nil {
+			return ev, nil
+		}
+	}
+}
+
+// Events streams chat events until the connection is closed or ctx is done.
+// The terminating error, if any, is sent on the error channel.
+func (c *ChatConn) Events(ctx context.Context) (<-chan ChatEvent, <-chan error) {
+	events := make(chan ChatEvent)
+	errc := make(chan error, 1)
+
+	stop := afterFunc(ctx, func() { c.ws.rwc.Close() })
+
+	go func() {
+		defer close(events)
+		defer close(errc)
+		defer stop()
+
+		for {
+			ev, err := c.Next()
+			if err != nil {
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				errc <- err
+				return
+			}
+
+			select {
+			case events <- *ev:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return events, errc
+}
+
+func (c *ChatConn) Close() error {
+	c.stop()
+	return c.ws.Close()
+}
+
+func parseChatEvent(m ChatMessage) *ChatEvent {
+	switch m.Kind {
+	case chatMessageKindChat:
+		payload, body, err := m.Decode()
+		if err != nil {
+			return nil
+		}
+
+		ev := &ChatEvent{
+			Time:        chatEventTime(payload, body),
+			UserID:      payload.Sender.UserID,
+			Username:    body.Username,
+			DisplayName: body.DisplayName,
+			Text:        body.Body,
+			Final:       body.Final,
+			Raw:         m,
+		}
+		if ev.Username == "" {
+			ev.Username = payload.Sender.Username
+		}
+		if ev.DisplayName == "" {
+			ev.DisplayName = payload.Sender.DisplayName
+		}
+
+		switch body.Type {
+		case ChatBodyTypeText:
+			ev.Type = ChatEventChat
+		case ChatBodyTypeReaction:
+			ev.Type = ChatEventReaction
+		case ChatBodyTypeCaption:
+			ev.Type = ChatEventCaption
+		default:
+			ev.Type = ChatEventUnknown
+		}
+		return ev
+
+	case chatMessageKindControl:
+		var control struct {
+			Kind   int `json:"kind"`
+			Sender struct {
+				UserID      string `json:"user_id"`
+				Username    string `json:"username"`
+				DisplayName string `json:"display_name"`
+			} `json:"sender"`
+			Timestamp int64 `json:"timestamp"`
+		}
+		if err := json.Unmarshal([]byte(m.Payload), &control); err != nil {
+			return nil
+		}
+
+		ev := &ChatEvent{
+			UserID:      control.Sender.UserID,
+			Username:    control.Sender.Username,
+			DisplayName: control.Sender.DisplayName,
+			Raw:         m,
+		}
+		if control.Timestamp != 0 {
+			ev.Time = time.Unix(0, control.Timestamp)
+		}
+
+		switch control.Kind {
+		case chatControlKindPresenceJoin:
+			ev.Type = ChatEventJoin
+		case chatControlKindPresenceLeave:
+			ev.Type = ChatEventLeave
+		default:
+			return nil
+		}
+		return ev
+	}
+
+	return nil
+}
+
+func chatEventTime(payload *ChatPayload, body *ChatBody) time.Time {
+	if body.Timestamp != 0 {
+		return unixMilli(body.Timestamp)
+	}
+	if payload.Timestamp != 0 {
+		return time.Unix(0, payload.Timestamp)
+	}
+	return time.Time{}
+}
+
+// afterFunc calls f once ctx is done, unless the returned stop function is called first
+func afterFunc(ctx context.Context, f func()) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
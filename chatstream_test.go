@@ -0,0 +1,78 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseChatEvent(t *testing.T) {
+	tests := []struct {
+		file string
+		want *ChatEvent
+	}{
+		{"text.json", &ChatEvent{Type: ChatEventChat, Time: unixMilli(1660000000123), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice", Text: "hello"}},
+		{"reaction.json", &ChatEvent{Type: ChatEventReaction, Time: unixMilli(1660000001000), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice", Text: "🔥"}},
+		{"caption.json", &ChatEvent{Type: ChatEventCaption, Time: unixMilli(1660000002500), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice", Text: "welcome to the space", Final: true}},
+		// the sender of the payload is used when the body has no user or timestamp
+		{"no_timestamp.json", &ChatEvent{Type: ChatEventChat, Time: time.Unix(0, 1660000003000000000), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice", Text: "hi"}},
+		{"unknown_type.json", &ChatEvent{Type: ChatEventUnknown, Time: time.Unix(0, 1660000000123456789), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice"}},
+		{"join.json", &ChatEvent{Type: ChatEventJoin, Time: time.Unix(0, 1660000004000000000), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice"}},
+		{"leave.json", &ChatEvent{Type: ChatEventLeave, Time: time.Unix(0, 1660000005000000000), UserID: "1yKAPgmejLjQv", Username: "alice", DisplayName: "Alice"}},
+		{"roster.json", nil},
+		{"auth.json", nil},
+		{"broken.json", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", "chat", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m ChatMessage
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+
+			got := parseChatEvent(m)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("got %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("got nil")
+			}
+			if got.Raw != m {
+				t.Errorf("Raw = %+v, want %+v", got.Raw, m)
+			}
+			got.Raw = ChatMessage{}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("Time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time = tt.want.Time
+			if *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
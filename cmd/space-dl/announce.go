@@ -0,0 +1,77 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	AnnounceFilename = "announce.txt"
+)
+
+func expandAnnounce(template, spaceID, title string, host *spacedl.User, dir string) string {
+	r := strings.NewReplacer(
+		"{space_id}", spaceID,
+		"{space_url}", "https://twitter.com/i/spaces/"+spaceID,
+		"{title}", title,
+		"{host}", host.TwitterScreenName,
+		"{dir}", filepath.Base(dir),
+	)
+	return r.Replace(template)
+}
+
+// announce drafts the announcement of the recording into the recording directory,
+// or posts it from the logged in session with --announce-post.
+func announce(spaceID, title string, host *spacedl.User, dir string, opts *options, logger *log.Logger) error {
+	text := expandAnnounce(opts.announce, spaceID, title, host, dir)
+
+	if !opts.announcePost {
+		file := filepath.Join(dir, AnnounceFilename)
+		if err := ioutil.WriteFile(file, []byte(text+"\n"), 0666); err != nil {
+			return err
+		}
+		logger.Printf("announcement drafted: %s\n", file)
+		return nil
+	}
+
+	// posted from the session itself, not from an account rotated by --account-cookies
+	clientOpts := opts.client
+	clientOpts.accounts = nil
+	client, err := newClient(&clientOpts)
+	if err != nil {
+		return err
+	}
+	if !client.Authenticated() {
+		return errors.New("posting an announcement requires a logged in session")
+	}
+
+	id, err := client.CreateTweet(text, opts.announceReplyTo)
+	if err != nil {
+		return fmt.Errorf("post announcement: %w", err)
+	}
+	logger.Printf("announcement posted: https://twitter.com/%s/status/%s\n", host.TwitterScreenName, id)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+type downloadArchive struct {
+	file string
+	mu   sync.Mutex
+}
+
+func newDownloadArchive(file string) *downloadArchive {
+	return &downloadArchive{
+		file: file,
+	}
+}
+
+func (a *downloadArchive) contains(spaceID string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if parseArchiveLine(scanner.Text()) == spaceID {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+func (a *downloadArchive) add(spaceID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, spaceID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseArchiveLine returns the space id of an archive line.
+// yt-dlp style lines ("twitterspaces <id>") are accepted, and lines of other extractors are ignored.
+func parseArchiveLine(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	if len(fields) == 2 && isYtdlpSpacesExtractor(fields[0]) {
+		return fields[1]
+	}
+	return ""
+}
+
+func isYtdlpSpacesExtractor(key string) bool {
+	switch strings.ToLower(key) {
+	case "twitterspaces", "twitter:spaces":
+		return true
+	}
+	return false
+}
+
+// readArchiveIDs returns the space ids recorded in an archive file.
+func readArchiveIDs(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id := parseArchiveLine(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, scanner.Err()
+}
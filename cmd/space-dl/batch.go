@@ -0,0 +1,153 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+func readBatchFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spaceIDs []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		spaceID, err := spacedl.ParseSpaceID(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+		spaceIDs = append(spaceIDs, spaceID)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return spaceIDs, nil
+}
+
+func runAll(spaceIDs []string, opts *options) int {
+	if opts.cassette != "" {
+		cassette, err := openCassette(opts.cassette)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer cassette.Close()
+		opts.client.transport = cassette
+	}
+
+	if len(spaceIDs) == 1 {
+		err := run(spaceIDs[0], opts)
+		if err != nil {
+			printError("", err)
+		}
+		return exitCode(err)
+	}
+
+	errs := make([]error, len(spaceIDs))
+	sem := make(chan struct{}, opts.batchJobs)
+	var wg sync.WaitGroup
+
+	for i, spaceID := range spaceIDs {
+		sem <- struct{}{}
+		select {
+		case <-shutdown:
+			<-sem
+			errs[i] = errShutdown
+			continue
+		default:
+		}
+		wg.Add(1)
+		go func(i int, spaceID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := run(spaceID, opts); err != nil {
+				printError(spaceID+": ", err)
+				errs[i] = err
+			}
+		}(i, spaceID)
+	}
+	wg.Wait()
+
+	code := 0
+	failed := 0
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed += 1
+		if c := exitCode(err); code == 0 || c == 1 {
+			code = c
+		}
+	}
+
+	fmt.Printf("batch: %d succeeded, %d failed\n", len(spaceIDs)-failed, failed)
+
+	return code
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, errWaitTimeout) {
+		return exitCodeWaitTimeout
+	}
+	return 1
+}
+
+func printError(prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s%v\n", prefix, err)
+
+	var qe *spacedl.QueryError
+	if errors.As(err, &qe) {
+		if hint := qe.Hint(); hint != "" {
+			fmt.Fprintf(os.Stderr, "%shint: %s\n", prefix, hint)
+		}
+	}
+
+	var re *spacedl.RestrictedSpaceError
+	if errors.As(err, &re) {
+		if re.Ticketed {
+			fmt.Fprintf(os.Stderr, "%shint: the space is ticketed, the audio is only available to an account holding a ticket\n", prefix)
+		} else {
+			fmt.Fprintf(os.Stderr, "%shint: the audio is only available to an account which can listen to the space\n", prefix)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+type requirement struct {
+	feature string
+	kind    string
+	name    string
+}
+
+func requirements(opts *options) []requirement {
+	reqs := []requirement{
+		{feature: "m4a output", kind: "muxer", name: "ipod"},
+		{feature: "m4a output", kind: "bsf", name: "aac_adtstoasc"},
+	}
+	if opts.replayGain {
+		reqs = append(reqs, requirement{feature: "--replaygain", kind: "filter", name: "loudnorm"})
+	}
+	if opts.chapters {
+		reqs = append(reqs, requirement{feature: "--chapters", kind: "filter", name: "silencedetect"})
+	}
+	if opts.silenceAlert > 0 {
+		reqs = append(reqs, requirement{feature: "--silence-alert", kind: "filter", name: "volumedetect"})
+	}
+	if opts.embedCaptions {
+		reqs = append(reqs, requirement{feature: "--embed-captions", kind: "encoder", name: "mov_text"})
+	}
+	for _, e := range opts.encodings {
+		reqs = append(reqs, requirement{feature: "--also-encode " + e.codec, kind: "encoder", name: e.encoder.name})
+	}
+	return reqs
+}
+
+func (r requirement) available(caps *spacedl.Capabilities) bool {
+	switch r.kind {
+	case "muxer":
+		return caps.Muxers[r.name]
+	case "encoder":
+		return caps.Encoders[r.name]
+	case "filter":
+		return caps.Filters[r.name]
+	case "bsf":
+		return caps.BSFs[r.name]
+	}
+	return false
+}
+
+func checkCapabilities(opts *options) error {
+	caps, err := opts.ffmpeg.Probe()
+	if err != nil {
+		return fmt.Errorf("ffmpeg not available (%s): %w", opts.ffmpeg.Path, err)
+	}
+
+	var missing []string
+	for _, r := range requirements(opts) {
+		if !r.available(caps) {
+			missing = append(missing, fmt.Sprintf("%s (%s %s)", r.feature, r.kind, r.name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("features unavailable with ffmpeg build (%s): %v", opts.ffmpeg.Path, missing)
+	}
+
+	return nil
+}
+
+func printCapabilities(opts *options) error {
+	caps, err := opts.ffmpeg.Probe()
+	if err != nil {
+		return err
+	}
+
+	all := []requirement{
+		{feature: "m4a output", kind: "muxer", name: "ipod"},
+		{feature: "m4a output", kind: "bsf", name: "aac_adtstoasc"},
+		{feature: "--replaygain", kind: "filter", name: "loudnorm"},
+		{feature: "--chapters", kind: "filter", name: "silencedetect"},
+		{feature: "--silence-alert", kind: "filter", name: "volumedetect"},
+		{feature: "--embed-captions", kind: "encoder", name: "mov_text"},
+	}
+	for _, codec := range []string{"opus", "mp3", "aac"} {
+		all = append(all, requirement{feature: "--also-encode " + codec, kind: "encoder", name: encoders[codec].name})
+	}
+
+	for _, r := range all {
+		status := "OK"
+		if !r.available(caps) {
+			status = "unavailable"
+		}
+		fmt.Printf("%-12s %-22s %s %s\n", status, r.feature, r.kind, r.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+func writeSRT(w io.Writer, cues []spacedl.CaptionCue) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		text := c.Text
+		if name := cueName(c); name != "" {
+			text = name + ": " + text
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(c.Start, ","), formatCueTime(c.End, ","), text)
+	}
+	return bw.Flush()
+}
+
+func writeVTT(w io.Writer, cues []spacedl.CaptionCue) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "WEBVTT\n\n")
+	for _, c := range cues {
+		text := c.Text
+		if name := cueName(c); name != "" {
+			text = fmt.Sprintf("<v %s>%s", name, text)
+		}
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n", formatCueTime(c.Start, "."), formatCueTime(c.End, "."), text)
+	}
+	return bw.Flush()
+}
+
+func cueName(c spacedl.CaptionCue) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Username
+}
+
+func formatCueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+func saveCaptionFile(file string, cues []spacedl.CaptionCue, write func(io.Writer, []spacedl.CaptionCue) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return write(f, cues)
+}
+
+func saveCaptions(messages []spacedl.ChatMessage, base time.Time, output string, logger *log.Logger) (string, error) {
+	captions := spacedl.ExtractCaptions(messages)
+	if len(captions) == 0 {
+		logger.Println("captions not found")
+		return "", nil
+	}
+
+	cues := spacedl.CaptionCues(captions, base)
+
+	srt := output + ".srt"
+	if err := saveCaptionFile(srt, cues, writeSRT); err != nil {
+		return "", err
+	}
+	if err := saveCaptionFile(output+".vtt", cues, writeVTT); err != nil {
+		return "", err
+	}
+
+	logger.Printf("captions: %d cues\n", len(cues))
+
+	return srt, nil
+}
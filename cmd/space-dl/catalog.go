@@ -0,0 +1,154 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+)
+
+func catalogCommand(args []string) int {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Fprintln(os.Stderr, "usage: space-dl catalog import --download-archive <file> [--yt-dlp-archive <file>] <dir>...")
+		return 1
+	}
+
+	var archiveFile string
+	var ytdlpArchives []string
+	flags := pflag.NewFlagSet("catalog import", pflag.ExitOnError)
+	flags.StringVar(&archiveFile, "download-archive", "", "download archive file to register recordings to")
+	flags.StringArrayVar(&ytdlpArchives, "yt-dlp-archive", nil, "yt-dlp download archive file to import twitter spaces ids from")
+	flags.Parse(args[1:])
+
+	if archiveFile == "" || (flags.NArg() == 0 && len(ytdlpArchives) == 0) {
+		fmt.Fprintln(os.Stderr, "usage: space-dl catalog import --download-archive <file> [--yt-dlp-archive <file>] <dir>...")
+		return 1
+	}
+
+	archive := newDownloadArchive(archiveFile)
+
+	code := 0
+	imported := 0
+	for _, file := range ytdlpArchives {
+		ids, err := readArchiveIDs(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			code = 1
+			continue
+		}
+
+		for _, spaceID := range ids {
+			archived, err := archive.contains(spaceID)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if archived {
+				continue
+			}
+
+			if err := archive.add(spaceID); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Printf("%s: imported %s\n", file, spaceID)
+			imported += 1
+		}
+	}
+
+	for _, root := range flags.Args() {
+		dirs, err := findRecordingDirs(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", root, err)
+			code = 1
+			continue
+		}
+
+		for _, dir := range dirs {
+			spaceID, err := readSpaceID(dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+				code = 1
+				continue
+			}
+			if !hasRecording(dir) {
+				fmt.Printf("%s: no recording found, skipped\n", dir)
+				continue
+			}
+
+			archived, err := archive.contains(spaceID)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if archived {
+				continue
+			}
+
+			if err := archive.add(spaceID); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Printf("%s: imported %s\n", dir, spaceID)
+			imported += 1
+		}
+	}
+
+	fmt.Printf("%d recordings imported\n", imported)
+
+	return code
+}
+
+// findRecordingDirs returns root itself if it is a recording directory, otherwise its recording subdirectories.
+func findRecordingDirs(root string) ([]string, error) {
+	root = filepath.Clean(root)
+	if isRecordingDir(root) {
+		return []string{root}, nil
+	}
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		dir := filepath.Join(root, entry.Name())
+		if entry.IsDir() && isRecordingDir(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs, nil
+}
+
+func isRecordingDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, MetadataFilename))
+	return err == nil
+}
+
+func hasRecording(dir string) bool {
+	if _, err := os.Stat(dir + ".m4a"); err == nil {
+		return true
+	}
+	parts, _ := filepath.Glob(dir + "-[0-9][0-9][0-9].m4a")
+	return len(parts) > 0
+}
@@ -0,0 +1,228 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	breakChapterTitle = "Break"
+)
+
+var (
+	silenceStartRegexp = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndRegexp   = regexp.MustCompile(`silence_end: ([0-9.]+)`)
+	progressTimeRegexp = regexp.MustCompile(`time=([0-9]+):([0-9]{2}):([0-9]{2}(?:\.[0-9]+)?)`)
+)
+
+type titleChange struct {
+	at    time.Duration
+	title string
+}
+
+type chapterTracker struct {
+	mu      sync.Mutex
+	base    time.Time
+	title   string
+	changes []titleChange
+}
+
+type silence struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func newChapterTracker(title string, base time.Time) *chapterTracker {
+	return &chapterTracker{
+		base:  base,
+		title: title,
+	}
+}
+
+func (t *chapterTracker) update(title string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if title == t.title {
+		return
+	}
+	t.title = title
+	t.changes = append(t.changes, titleChange{
+		at:    now.Sub(t.base),
+		title: title,
+	})
+}
+
+func (t *chapterTracker) titleChanges() []titleChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.changes
+}
+
+func detectBreaks(files []string, opts *options, logger *log.Logger) ([]silence, time.Duration, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:d=%g", opts.breakNoise, opts.breakMinDuration.Seconds())
+	cmd := opts.ffmpeg.Command("-hide_banner", "-i", "pipe:0", "-af", filter, "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := startProcess(cmd, opts.priority, logger); err != nil {
+		return nil, 0, err
+	}
+
+	if err := writeFiles(stdin, files); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, 0, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, 0, err
+	}
+
+	out := stderr.Bytes()
+
+	var total time.Duration
+	if matches := progressTimeRegexp.FindAllSubmatch(out, -1); len(matches) > 0 {
+		m := matches[len(matches)-1]
+		h, _ := strconv.Atoi(string(m[1]))
+		min, _ := strconv.Atoi(string(m[2]))
+		sec, _ := strconv.ParseFloat(string(m[3]), 64)
+		total = time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + seconds(sec)
+	}
+
+	starts := silenceStartRegexp.FindAllSubmatch(out, -1)
+	ends := silenceEndRegexp.FindAllSubmatch(out, -1)
+
+	var breaks []silence
+	for i, m := range starts {
+		start, _ := strconv.ParseFloat(string(m[1]), 64)
+		b := silence{
+			start: seconds(start),
+			end:   total,
+		}
+		if i < len(ends) {
+			end, _ := strconv.ParseFloat(string(ends[i][1]), 64)
+			b.end = seconds(end)
+		}
+		if b.start < 0 {
+			b.start = 0
+		}
+		breaks = append(breaks, b)
+	}
+
+	return breaks, total, nil
+}
+
+func buildChapters(title string, changes []titleChange, breaks []silence, total time.Duration) []spacedl.Chapter {
+	type boundary struct {
+		at    time.Duration
+		title string
+	}
+
+	titleAt := func(at time.Duration) string {
+		t := title
+		for _, c := range changes {
+			if c.at <= at {
+				t = c.title
+			}
+		}
+		return t
+	}
+
+	bounds := []boundary{{at: 0, title: title}}
+	for _, c := range changes {
+		bounds = append(bounds, boundary{at: c.at, title: c.title})
+	}
+	for _, b := range breaks {
+		bounds = append(bounds, boundary{at: b.start, title: breakChapterTitle})
+		if b.end < total {
+			bounds = append(bounds, boundary{at: b.end, title: titleAt(b.end)})
+		}
+	}
+
+	sort.SliceStable(bounds, func(i, j int) bool {
+		return bounds[i].at < bounds[j].at
+	})
+
+	var chapters []spacedl.Chapter
+	for i, b := range bounds {
+		if b.at < 0 || b.at >= total {
+			continue
+		}
+		end := total
+		if i+1 < len(bounds) && bounds[i+1].at < total {
+			end = bounds[i+1].at
+		}
+		if end <= b.at {
+			continue
+		}
+		if n := len(chapters); n > 0 && chapters[n-1].Title == b.title {
+			chapters[n-1].End = end
+			continue
+		}
+		chapters = append(chapters, spacedl.Chapter{
+			Start: b.at,
+			End:   end,
+			Title: b.title,
+		})
+	}
+
+	return chapters
+}
+
+func addChapters(files []string, meta *spacedl.Metadata, title string, tracker *chapterTracker, opts *options, logger *log.Logger) error {
+	logger.Println("detect breaks")
+
+	breaks, total, err := detectBreaks(files, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	var changes []titleChange
+	if tracker != nil {
+		changes = tracker.titleChanges()
+	}
+
+	chapters := buildChapters(title, changes, breaks, total)
+	logger.Printf("chapters: %d (breaks: %d, title changes: %d)\n", len(chapters), len(breaks), len(changes))
+
+	meta.ClearChapters()
+	for _, c := range chapters {
+		meta.AddChapter(c)
+	}
+
+	return nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,191 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	chatPollInterval = 30 * time.Second
+)
+
+type chatLine struct {
+	Time        time.Time       `json:"time"`
+	Kind        int             `json:"kind"`
+	Type        int             `json:"type"`
+	UserID      string          `json:"user_id,omitempty"`
+	Username    string          `json:"username,omitempty"`
+	DisplayName string          `json:"display_name,omitempty"`
+	Body        string          `json:"body,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+type chatRecorder struct {
+	client *spacedl.Client
+	access *spacedl.ChatAccess
+	logger *log.Logger
+
+	mu       sync.Mutex
+	seen     map[string]bool
+	messages []spacedl.ChatMessage
+	file     *os.File
+}
+
+func newChatRecorder(client *spacedl.Client, chatToken string, file string, logger *log.Logger) (*chatRecorder, error) {
+	access, err := client.AccessChat(chatToken)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &chatRecorder{
+		client: client,
+		access: access,
+		logger: logger,
+		seen:   make(map[string]bool),
+	}
+
+	if file != "" {
+		r.file, err = os.Create(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *chatRecorder) start(interval time.Duration) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C():
+				if err := r.poll(); err != nil {
+					r.logger.Printf("chat error: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (r *chatRecorder) poll() error {
+	messages, err := r.client.GetChatHistory(r.access)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines []chatLine
+	for _, m := range messages {
+		if r.seen[m.Payload] {
+			continue
+		}
+		r.seen[m.Payload] = true
+		r.messages = append(r.messages, m)
+
+		if r.file != nil {
+			if line, ok := newChatLine(m); ok {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	if r.file == nil {
+		return nil
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+
+	enc := json.NewEncoder(r.file)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *chatRecorder) Messages() []spacedl.ChatMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.messages
+}
+
+func (r *chatRecorder) Close() error {
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
+
+func newChatLine(m spacedl.ChatMessage) (chatLine, bool) {
+	payload, body, err := m.Decode()
+	if payload == nil {
+		return chatLine{}, false
+	}
+
+	line := chatLine{
+		Time:        time.Unix(0, payload.Timestamp),
+		Kind:        m.Kind,
+		UserID:      payload.Sender.UserID,
+		Username:    payload.Sender.Username,
+		DisplayName: payload.Sender.DisplayName,
+		Payload:     json.RawMessage(m.Payload),
+	}
+
+	if err == nil {
+		line.Type = body.Type
+		line.Body = body.Body
+		if body.Timestamp != 0 {
+			line.Time = time.Unix(body.Timestamp/1000, body.Timestamp%1000*int64(time.Millisecond))
+		}
+		if line.Username == "" {
+			line.Username = body.Username
+		}
+		if line.DisplayName == "" {
+			line.DisplayName = body.DisplayName
+		}
+	}
+
+	return line, true
+}
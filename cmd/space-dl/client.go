@@ -0,0 +1,414 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	authTokenEnv = "SPACE_DL_AUTH_TOKEN"
+	ct0Env       = "SPACE_DL_CT0"
+)
+
+type clientOptions struct {
+	userAgent string
+	authToken string
+	ct0       string
+	cookies   string
+
+	rateLimitWait   time.Duration
+	requestRetries  int
+	tokenCache      string
+	tokenCacheTTL   time.Duration
+	operations      string
+	proxies         []string
+	proxyRotation   string
+	accounts        []string
+	guestTokens     int
+	queryCache      time.Duration
+	streamHosts     []string
+	pinStreamHost   bool
+	traceRequests   bool
+	xCom            bool
+	endpoints       []string
+	accountRotation string
+	headers         []string
+	transactionCmd  string
+	offlineInit     bool
+	features        []string
+	debugDump       string
+
+	// transport replaces the network of the client and the downloaders, e.g. by a cassette
+	transport http.RoundTripper
+}
+
+func addClientFlags(flags *pflag.FlagSet, opts *clientOptions) {
+	flags.StringVar(&opts.userAgent, "user-agent", spacedl.DefaultUserAgent, "user agent of http requests")
+	flags.StringVar(&opts.authToken, "auth-token", "", "auth_token cookie of a logged in session (or "+authTokenEnv+")")
+	flags.StringVar(&opts.ct0, "ct0", "", "ct0 cookie of a logged in session (or "+ct0Env+")")
+	flags.DurationVar(&opts.rateLimitWait, "rate-limit-wait", 15*time.Minute, "wait until the rate limit is reset if it is within the duration, 0 to fail immediately")
+	flags.IntVar(&opts.requestRetries, "request-retries", spacedl.DefaultRetryPolicy.MaxAttempts-1, "retries of a http request failed with 5xx or a network error, with exponential backoff")
+	flags.StringVar(&opts.tokenCache, "token-cache", defaultTokenCacheFile(), "cache file of the tokens and operations fetched from twitter.com, empty to disable")
+	flags.DurationVar(&opts.tokenCacheTTL, "token-cache-ttl", time.Hour, "how long the token cache is used")
+	flags.StringVar(&opts.operations, "operations", "", "json file of graphql operations to use instead of the ones found on twitter.com")
+	flags.StringSliceVar(&opts.proxies, "proxy", nil, "proxy url of twitter api requests, can be given multiple times to rotate proxies")
+	flags.StringVar(&opts.proxyRotation, "proxy-rotation", "request", "when to switch proxies (request, rate-limit)")
+	flags.StringArrayVar(&opts.accounts, "account-cookies", nil, "cookies.txt of another logged in account, can be given multiple times to rotate accounts")
+	flags.StringVar(&opts.accountRotation, "account-rotation", "rate-limit", "when to switch accounts (request, rate-limit)")
+	flags.StringSliceVar(&opts.streamHosts, "stream-host", nil, "preferred edge host of the stream, {region} is replaced by the region of the stream, can be given multiple times")
+	flags.BoolVar(&opts.pinStreamHost, "pin-stream-host", false, "always use the first --stream-host without checking it")
+	flags.BoolVar(&opts.xCom, "x-com", false, "use the apis on x.com instead of twitter.com")
+	flags.StringSliceVar(&opts.endpoints, "endpoint", nil, "override an api url, name=url (index, service-worker, guest-graphql, graphql, guest-activate, live-video-stream, avatar-content)")
+	flags.BoolVar(&opts.traceRequests, "trace-requests", false, "log the dns, connect, tls and time to first byte of each request")
+	flags.DurationVar(&opts.queryCache, "query-cache", 0, "reuse the responses of the same twitter api queries within the duration, 0 to disable")
+	flags.IntVar(&opts.guestTokens, "guest-tokens", 1, "number of guest tokens used in turn, refreshed in the background before they expire")
+	flags.StringArrayVarP(&opts.headers, "header", "H", nil, "add a header to twitter api requests, \"Name: value\"")
+	flags.StringVar(&opts.transactionCmd, "transaction-id-command", "", "command printing x-client-transaction-id, called with the method and path of each request")
+	flags.BoolVar(&opts.offlineInit, "offline-init", false, "do not download twitter.com and the bundles, use the built-in bearer token and operations (see --operations)")
+	flags.StringSliceVar(&opts.features, "feature", nil, "override a graphql feature flag, name=true|false")
+	flags.StringVar(&opts.debugDump, "debug-dump", "", "append twitter api requests and responses to the file as json lines, with tokens redacted")
+	flags.StringVar(&opts.cookies, "cookies", "", "load cookies of twitter.com and x.com from the Netscape format cookies.txt")
+}
+
+func newClient(opts *clientOptions) (*spacedl.Client, error) {
+	client, err := buildClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := initializeClient(client, opts); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// buildClient makes a client with the options without initializing it
+func buildClient(opts *clientOptions) (*spacedl.Client, error) {
+	clientOpts := []spacedl.ClientOption{
+		spacedl.WithUserAgent(opts.userAgent),
+		spacedl.WithRateLimitWait(opts.rateLimitWait),
+		spacedl.WithLogger(log.New(os.Stdout, "", 0)),
+		spacedl.WithClock(clock),
+		spacedl.WithHooks(traceHooks(opts.traceRequests, log.New(os.Stdout, "", 0))),
+	}
+
+	// set first, the debug dump wraps the transport
+	if opts.transport != nil {
+		clientOpts = append(clientOpts, spacedl.WithTransport(opts.transport))
+	}
+
+	if opts.operations != "" {
+		operations, err := readOperationsFile(opts.operations)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, spacedl.WithOperations(operations))
+	}
+
+	for _, h := range opts.headers {
+		key, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header: %s", h)
+		}
+		clientOpts = append(clientOpts, spacedl.WithHeader(strings.TrimSpace(key), strings.TrimSpace(value)))
+	}
+
+	if len(opts.features) > 0 {
+		features := make(map[string]bool)
+		for _, f := range opts.features {
+			name, value, ok := strings.Cut(f, "=")
+			v, err := strconv.ParseBool(value)
+			if !ok || name == "" || err != nil {
+				return nil, fmt.Errorf("invalid feature: %s", f)
+			}
+			features[name] = v
+		}
+		clientOpts = append(clientOpts, spacedl.WithFeatures(features))
+	}
+
+	if opts.debugDump != "" {
+		f, err := openDebugDump(opts.debugDump)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, spacedl.WithDebugDump(f))
+	}
+
+	if opts.transactionCmd != "" {
+		clientOpts = append(clientOpts, spacedl.WithTransactionIDProvider(commandTransactionID(opts.transactionCmd)))
+	}
+
+	if len(opts.proxies) > 0 {
+		proxyOpt, err := proxyOption(opts.proxies, opts.proxyRotation)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, proxyOpt)
+	}
+
+	if opts.xCom || len(opts.endpoints) > 0 {
+		endpointsOpt, err := endpointsOption(opts.xCom, opts.endpoints)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, endpointsOpt)
+	}
+
+	if len(opts.streamHosts) > 0 {
+		clientOpts = append(clientOpts, spacedl.WithStreamHosts(opts.streamHosts, opts.pinStreamHost))
+	}
+
+	if opts.queryCache > 0 {
+		clientOpts = append(clientOpts, spacedl.WithQueryCache(opts.queryCache))
+	}
+
+	if opts.guestTokens > 1 {
+		clientOpts = append(clientOpts, spacedl.WithGuestTokenPool(opts.guestTokens, spacedl.DefaultGuestTokenTTL))
+	}
+
+	if opts.tokenCache != "" {
+		clientOpts = append(clientOpts, spacedl.WithTokenCache(opts.tokenCache, opts.tokenCacheTTL))
+	}
+
+	policy := spacedl.DefaultRetryPolicy
+	policy.MaxAttempts = opts.requestRetries + 1
+	clientOpts = append(clientOpts, spacedl.WithRetryPolicy(policy))
+
+	authToken, ct0 := opts.authToken, opts.ct0
+	if authToken == "" {
+		authToken = os.Getenv(authTokenEnv)
+	}
+	if ct0 == "" {
+		ct0 = os.Getenv(ct0Env)
+	}
+	if (authToken == "") != (ct0 == "") {
+		return nil, errors.New("both auth_token and ct0 are required for a logged in session")
+	}
+	if authToken != "" {
+		clientOpts = append(clientOpts, spacedl.WithSession(authToken, ct0))
+	}
+
+	if opts.cookies != "" {
+		cookies, err := readCookiesFile(opts.cookies)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, spacedl.WithCookies(cookies))
+	}
+
+	if len(opts.accounts) > 0 {
+		accountOpt, err := accountOption(opts.accounts, opts.accountRotation)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, accountOpt)
+	}
+
+	return spacedl.NewClient(clientOpts...)
+}
+
+func initializeClient(client *spacedl.Client, opts *clientOptions) error {
+	if opts.offlineInit {
+		return client.InitializeOffline()
+	}
+	return client.Initialize()
+}
+
+// downloaderHTTPClient returns the http.Client of the downloaders, nil for the default one
+func (opts *clientOptions) downloaderHTTPClient() *http.Client {
+	if opts.transport == nil {
+		return nil
+	}
+	return &http.Client{Transport: opts.transport}
+}
+
+func readCookiesFile(file string) ([]*http.Cookie, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cookies, err := spacedl.ReadCookiesTxt(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return cookies, nil
+}
+
+func defaultTokenCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "space-dl", "tokens.json")
+}
+
+func readOperationsFile(file string) ([]*spacedl.Operation, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	operations, err := spacedl.ReadOperations(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return operations, nil
+}
+
+func proxyOption(proxies []string, rotation string) (spacedl.ClientOption, error) {
+	var urls []*url.URL
+	for _, p := range proxies {
+		u, err := url.Parse(p)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy: %s", p)
+		}
+		urls = append(urls, u)
+	}
+
+	switch rotation {
+	case "request":
+		return spacedl.WithProxies(urls, spacedl.RotatePerRequest), nil
+	case "rate-limit":
+		return spacedl.WithProxies(urls, spacedl.RotateOnRateLimit), nil
+	}
+	return nil, fmt.Errorf("invalid proxy rotation: %s", rotation)
+}
+
+func endpointsOption(xCom bool, overrides []string) (spacedl.ClientOption, error) {
+	endpoints := spacedl.DefaultEndpoints
+	if xCom {
+		endpoints = spacedl.XEndpoints
+	}
+
+	fields := map[string]*string{
+		"index":             &endpoints.Index,
+		"service-worker":    &endpoints.ServiceWorker,
+		"guest-graphql":     &endpoints.GuestGraphQL,
+		"graphql":           &endpoints.GraphQL,
+		"guest-activate":    &endpoints.GuestActivate,
+		"live-video-stream": &endpoints.LiveVideoStream,
+		"avatar-content":    &endpoints.AvatarContent,
+	}
+	for _, o := range overrides {
+		name, value, ok := strings.Cut(o, "=")
+		field, known := fields[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid endpoint: %s", o)
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint url: %s", o)
+		}
+		*field = value
+	}
+
+	return spacedl.WithEndpoints(endpoints), nil
+}
+
+func accountOption(files []string, rotation string) (spacedl.ClientOption, error) {
+	var accounts []spacedl.Account
+	for _, file := range files {
+		cookies, err := readCookiesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		account, err := spacedl.AccountFromCookies(cookies)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	switch rotation {
+	case "request":
+		return spacedl.WithAccounts(accounts, spacedl.RotatePerRequest), nil
+	case "rate-limit":
+		return spacedl.WithAccounts(accounts, spacedl.RotateOnRateLimit), nil
+	}
+	return nil, fmt.Errorf("invalid account rotation: %s", rotation)
+}
+
+// commandTransactionID runs the command to generate x-client-transaction-id
+func commandTransactionID(command string) spacedl.TransactionIDFunc {
+	return func(method, path string) (string, error) {
+		args := strings.Fields(command)
+		args = append(args, method, path)
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("transaction id command error: %w", err)
+		}
+		id := strings.TrimSpace(string(out))
+		if id == "" {
+			return "", errors.New("transaction id command printed nothing")
+		}
+		return id, nil
+	}
+}
+
+var (
+	debugDumpMu    sync.Mutex
+	debugDumpFiles = make(map[string]*debugDumpWriter)
+)
+
+// debugDumpWriter serializes the writes of clients sharing the dump file
+type debugDumpWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (w *debugDumpWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Write(p)
+}
+
+// openDebugDump opens the dump file once, clients of batch jobs share it until exit
+func openDebugDump(file string) (*debugDumpWriter, error) {
+	debugDumpMu.Lock()
+	defer debugDumpMu.Unlock()
+
+	if w, ok := debugDumpFiles[file]; ok {
+		return w, nil
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &debugDumpWriter{f: f}
+	debugDumpFiles[file] = w
+	return w, nil
+}
@@ -0,0 +1,288 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	ConfigFilename = "config.yaml"
+)
+
+var (
+	// flags which make no sense in a config file
+	configExcludedFlags = map[string]bool{
+		"help":            true,
+		"check":           true,
+		"config":          true,
+		"list-operations": true,
+		"batch-file":      true,
+	}
+
+	configValidators = map[string]func(string) error{
+		"finalize-method": func(s string) error {
+			_, err := parseFinalizeMethod(s)
+			return err
+		},
+		"timezone": func(s string) error {
+			_, err := loadTimezone(s)
+			return err
+		},
+		"disk-warn-space": func(s string) error {
+			_, err := parseSize(s)
+			return err
+		},
+		"disk-stop-space": func(s string) error {
+			_, err := parseSize(s)
+			return err
+		},
+		"also-encode": func(s string) error {
+			for _, e := range strings.Split(s, ",") {
+				if _, err := parseEncoding(strings.TrimSpace(e)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"ionice": func(s string) error {
+			var p processPriority
+			return p.parseIOClass(s)
+		},
+	}
+)
+
+type configEntry struct {
+	line  int
+	key   string
+	value string
+}
+
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "space-dl", ConfigFilename)
+}
+
+func readConfig(file string) ([]configEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []configEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\"", file, n)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+
+		entries = append(entries, configEntry{
+			line:  n,
+			key:   strings.TrimSpace(key),
+			value: value,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseConfigValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", errors.New("unterminated quote")
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+
+	// trailing comment
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// applyConfig sets flags from the config file, flags given on the command line take precedence
+func applyConfig(flags *pflag.FlagSet, file string) error {
+	entries, err := readConfig(file)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := setConfigFlag(flags, e); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, e.line, err)
+		}
+	}
+
+	return nil
+}
+
+func setConfigFlag(flags *pflag.FlagSet, e configEntry) error {
+	flag := flags.Lookup(e.key)
+	if flag == nil || configExcludedFlags[e.key] {
+		return fmt.Errorf("unknown key: %s", e.key)
+	}
+	if flag.Changed {
+		return nil
+	}
+	if err := flags.Set(e.key, e.value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", e.key, err)
+	}
+	if validate, ok := configValidators[e.key]; ok {
+		if err := validate(e.value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", e.key, err)
+		}
+	}
+	return nil
+}
+
+func configCommand(args []string) int {
+	usageText := "usage: space-dl config init|check [file]"
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, usageText)
+		return 1
+	}
+
+	file := defaultConfigFile()
+	if len(args) == 2 {
+		file = args[1]
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "config file location unknown, give a file")
+		return 1
+	}
+
+	var err error
+	switch args[0] {
+	case "init":
+		err = initConfig(pflag.CommandLine, file)
+	case "check":
+		err = checkConfig(pflag.CommandLine, file)
+	default:
+		fmt.Fprintln(os.Stderr, usageText)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func initConfig(flags *pflag.FlagSet, file string) error {
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("%s already exists", file)
+	}
+
+	var b strings.Builder
+	b.WriteString("# space-dl config\n")
+	b.WriteString("# keys are the long option names, options given on the command line take precedence.\n")
+	b.WriteString("# uncomment and edit the lines to change the defaults.\n")
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if configExcludedFlags[flag.Name] || flag.Hidden {
+			return
+		}
+		fmt.Fprintf(&b, "\n# %s\n", flag.Usage)
+		fmt.Fprintf(&b, "#%s: %s\n", flag.Name, formatConfigValue(flag.DefValue))
+	})
+
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, []byte(b.String()), 0666); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s created\n", file)
+
+	return nil
+}
+
+func formatConfigValue(s string) string {
+	// slice flags have "[a,b]" defaults
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" || strings.ContainsAny(s, "#:'\"") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func checkConfig(flags *pflag.FlagSet, file string) error {
+	entries, err := readConfig(file)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, e := range entries {
+		if err := setConfigFlag(flags, e); err != nil {
+			fmt.Printf("%s:%d: %v\n", file, e.line, err)
+			problems += 1
+		}
+	}
+
+	ffmpegPath := ""
+	if flag := flags.Lookup("ffmpeg-path"); flag != nil {
+		ffmpegPath = flag.Value.String()
+	}
+	ffmpeg := spacedl.NewFFmpeg(ffmpegPath)
+	if err := ffmpeg.Check(); err != nil {
+		fmt.Printf("%s: ffmpeg is not available (%s): %v\n", file, ffmpeg.Path, err)
+		problems += 1
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%s: %d problems found", file, problems)
+	}
+
+	fmt.Printf("%s: OK\n", file)
+
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskCheckInterval = 30 * time.Second
+)
+
+var (
+	sizeUnits = map[string]uint64{
+		"":  1,
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}
+)
+
+func parseSize(s string) (uint64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+
+	i := strings.IndexFunc(t, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := t, ""
+	if i >= 0 {
+		num, unit = t[:i], t[i:]
+	}
+
+	mul, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return uint64(n * float64(mul)), nil
+}
+
+func formatSize(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+func checkDiskSpace(dir string, opts *options) error {
+	if opts.diskStop == 0 {
+		return nil
+	}
+
+	free, err := diskFreeSpace(dir)
+	if err != nil {
+		return err
+	}
+	if free < opts.diskStop {
+		return fmt.Errorf("not enough disk space: %s free in %s", formatSize(free), dir)
+	}
+
+	return nil
+}
+
+// checkFinalizeSpace checks that the output directory can hold the files concatenated from the segments
+func checkFinalizeSpace(dir string, files []string, opts *options) error {
+	if opts.diskStop == 0 {
+		return nil
+	}
+
+	var size uint64
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		size += uint64(fi.Size())
+	}
+
+	free, err := diskFreeSpace(dir)
+	if err != nil {
+		return err
+	}
+	if free < size+opts.diskStop {
+		return fmt.Errorf("not enough disk space to finalize: %s required, %s free in %s", formatSize(size), formatSize(free), dir)
+	}
+
+	return nil
+}
+
+// startDiskGuard halts when any of dirs runs out of space, the scratch and the output directories may be on different disks
+func startDiskGuard(dirs []string, opts *options, logger *log.Logger, halt func()) func() {
+	if opts.diskWarn == 0 && opts.diskStop == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := clock.NewTicker(diskCheckInterval)
+		defer ticker.Stop()
+
+		warned := make(map[string]bool)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C():
+				for _, dir := range dirs {
+					free, err := diskFreeSpace(dir)
+					if err != nil {
+						logger.Printf("disk space check error: %v\n", err)
+						continue
+					}
+					if free < opts.diskStop {
+						logger.Printf("WARNING: disk space is running out (%s free in %s), stop recording\n", formatSize(free), dir)
+						halt()
+						return
+					}
+					if free < opts.diskWarn {
+						if !warned[dir] {
+							logger.Printf("WARNING: low disk space (%s free in %s)\n", formatSize(free), dir)
+							warned[dir] = true
+						}
+					} else {
+						warned[dir] = false
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// guardDirs returns the directories watched by the disk guard
+func guardDirs(segDir, dir string) []string {
+	if segDir == dir {
+		return []string{dir}
+	}
+	return []string{segDir, dir}
+}
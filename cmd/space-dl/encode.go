@@ -0,0 +1,77 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type encoder struct {
+	name    string
+	ext     string
+	bitrate string
+}
+
+var (
+	encoders = map[string]encoder{
+		"opus": {name: "libopus", ext: ".opus", bitrate: "32k"},
+		"mp3":  {name: "libmp3lame", ext: ".mp3", bitrate: "64k"},
+		"aac":  {name: "aac", ext: ".m4a", bitrate: "48k"},
+	}
+
+	bitrateRegexp = regexp.MustCompile(`^[0-9]+k?$`)
+)
+
+type encoding struct {
+	codec   string
+	encoder encoder
+	bitrate string
+}
+
+func parseEncoding(s string) (encoding, error) {
+	codec, bitrate, _ := strings.Cut(s, ":")
+	enc, ok := encoders[codec]
+	if !ok {
+		return encoding{}, fmt.Errorf("invalid encoding: %s: unknown codec %q (opus, mp3, aac)", s, codec)
+	}
+	if bitrate == "" {
+		bitrate = enc.bitrate
+	}
+	if !bitrateRegexp.MatchString(bitrate) {
+		return encoding{}, fmt.Errorf("invalid encoding: %s: invalid bitrate %q", s, bitrate)
+	}
+	return encoding{
+		codec:   codec,
+		encoder: enc,
+		bitrate: bitrate,
+	}, nil
+}
+
+func (e encoding) output(output string) string {
+	base := strings.TrimSuffix(output, ".m4a")
+	return base + "." + e.bitrate + e.encoder.ext
+}
+
+func (e encoding) args() []string {
+	return []string{
+		"-map", "0:a",
+		"-codec:a", e.encoder.name,
+		"-b:a", e.bitrate,
+	}
+}
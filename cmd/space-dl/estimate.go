@@ -0,0 +1,155 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	// typical bitrate of space audio streams
+	defaultEstimateBitrate = "64k"
+)
+
+func estimateCommand(args []string) int {
+	var clientOpts clientOptions
+	var batchFile string
+	var bitrate string
+	var assumed time.Duration
+	flags := pflag.NewFlagSet("estimate", pflag.ExitOnError)
+	flags.StringVar(&batchFile, "batch-file", "", "file containing space ids or urls, one per line")
+	flags.StringVar(&bitrate, "bitrate", defaultEstimateBitrate, "audio bitrate in bits per second")
+	flags.DurationVar(&assumed, "duration", 1*time.Hour, "duration assumed for scheduled and running spaces")
+	addClientFlags(flags, &clientOpts)
+	flags.Parse(args)
+
+	bps, err := parseBitrate(bitrate)
+	if err != nil || bps == 0 {
+		fmt.Fprintf(os.Stderr, "invalid bitrate: %s\n", bitrate)
+		return 1
+	}
+
+	var spaceIDs []string
+	for _, arg := range flags.Args() {
+		spaceID, err := spacedl.ParseSpaceID(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		spaceIDs = append(spaceIDs, spaceID)
+	}
+	if batchFile != "" {
+		ids, err := readBatchFile(batchFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		spaceIDs = append(spaceIDs, ids...)
+	}
+	if len(spaceIDs) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl estimate [--batch-file <file>] <space_id|space_url>...")
+		return 1
+	}
+
+	client, err := newClient(&clientOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SPACE\tSTATE\tDURATION\tDOWNLOAD\tSTORAGE")
+
+	code := 0
+	var totalDuration time.Duration
+	var totalBytes uint64
+	for _, spaceID := range spaceIDs {
+		resp, _, err := getAudioSpaceInfo(client, buildAudioSpaceInfoParams(spaceID))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", spaceID, err)
+			code = 1
+			continue
+		}
+
+		state := resp.Data.AudioSpace.Metadata.State
+		duration, exact := estimateDuration(resp, assumed)
+		size := uint64(duration.Seconds() * float64(bps) / 8)
+
+		d := duration.Round(time.Minute).String()
+		if !exact {
+			d = "~" + d
+		}
+		// segments and the concatenated output exist at the same time while finalizing
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", spaceID, state, d, formatSize(size), formatSize(size*2))
+
+		totalDuration += duration
+		totalBytes += size
+	}
+	fmt.Fprintf(w, "total\t\t%s\t%s\t%s\n", totalDuration.Round(time.Minute), formatSize(totalBytes), formatSize(totalBytes*2))
+	w.Flush()
+
+	fmt.Printf("\nbandwidth per live recording: %.1f kbps\n", float64(bps)/1000)
+
+	return code
+}
+
+// estimateDuration returns the duration of ended spaces, or the assumed duration otherwise
+func estimateDuration(resp *spacedl.AudioSpaceByIDResponse, assumed time.Duration) (time.Duration, bool) {
+	metadata := resp.Data.AudioSpace.Metadata
+	if isSpaceEnded(resp) {
+		endedAt, err := strconv.ParseInt(metadata.EndedAt, 10, 64)
+		if err == nil && metadata.StartedAt > 0 && endedAt > metadata.StartedAt {
+			return time.Duration(endedAt-metadata.StartedAt) * time.Millisecond, true
+		}
+	}
+
+	// running spaces are assumed to last at least the given duration
+	if metadata.StartedAt > 0 {
+		elapsed := time.Since(time.Unix(metadata.StartedAt/1000, 0))
+		if elapsed > assumed {
+			return elapsed, false
+		}
+	}
+
+	return assumed, false
+}
+
+func parseBitrate(s string) (uint64, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	mul := uint64(1)
+	if strings.HasSuffix(t, "k") {
+		mul = 1000
+		t = strings.TrimSuffix(t, "k")
+	} else if strings.HasSuffix(t, "m") {
+		mul = 1000 * 1000
+		t = strings.TrimSuffix(t, "m")
+	}
+	n, err := strconv.ParseUint(t, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mul, nil
+}
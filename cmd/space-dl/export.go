@@ -0,0 +1,243 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type exportManifest struct {
+	SpaceID   string         `json:"space_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []manifestFile `json:"files"`
+}
+
+func exportCommand(args []string) int {
+	var bundle string
+	var output string
+	var gpgKey string
+	flags := pflag.NewFlagSet("export", pflag.ExitOnError)
+	flags.StringVar(&bundle, "bundle", "zip", "bundle format (zip)")
+	flags.StringVarP(&output, "output", "o", "", "output file (default: <dir>.<bundle>)")
+	flags.StringVar(&gpgKey, "gpg-sign", "", "sign the manifest with the gpg key")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl export [--bundle zip] [--gpg-sign <key>] [-o <file>] <dir>")
+		return 1
+	}
+	if bundle != "zip" {
+		fmt.Fprintf(os.Stderr, "unsupported bundle format: %s\n", bundle)
+		return 1
+	}
+
+	dir := filepath.Clean(flags.Arg(0))
+	if output == "" {
+		output = dir + "." + bundle
+	}
+
+	if err := exportBundle(dir, output, gpgKey); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Remove(output)
+		return 1
+	}
+
+	fmt.Printf("%s created\n", output)
+
+	return 0
+}
+
+func exportBundle(dir, output, gpgKey string) error {
+	spaceID, err := readSpaceID(dir)
+	if err != nil {
+		return err
+	}
+
+	files, err := exportFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	// paths in the bundle are relative to the parent of the recording directory
+	base := filepath.Dir(dir)
+
+	manifest := exportManifest{
+		SpaceID:   spaceID,
+		CreatedAt: time.Now(),
+	}
+	var sums strings.Builder
+	for _, file := range files {
+		size, sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		manifest.Files = append(manifest.Files, manifestFile{
+			Path:   rel,
+			Size:   size,
+			SHA256: sum,
+		})
+		fmt.Fprintf(&sums, "%s  %s\n", sum, rel)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var signature []byte
+	if gpgKey != "" {
+		if signature, err = gpgSign(gpgKey, manifestJSON); err != nil {
+			return fmt.Errorf("gpg sign error: %w", err)
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for i, file := range files {
+		if err := addZipFile(zw, manifest.Files[i].Path, file); err != nil {
+			return err
+		}
+	}
+	extras := map[string][]byte{
+		"manifest.json": manifestJSON,
+		"SHA256SUMS":    []byte(sums.String()),
+	}
+	if signature != nil {
+		extras["manifest.json.asc"] = signature
+	}
+	for _, name := range []string{"manifest.json", "manifest.json.asc", "SHA256SUMS"} {
+		data, ok := extras[name]
+		if !ok {
+			continue
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// exportFiles returns files in the recording directory and outputs next to it
+func exportFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range []string{dir + ".*", dir + "-[0-9][0-9][0-9].*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			// skip previous bundles
+			if filepath.Ext(m) == ".zip" {
+				continue
+			}
+			if fi, err := os.Stat(m); err == nil && fi.Mode().IsRegular() {
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func addZipFile(zw *zip.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func gpgSign(key string, data []byte) ([]byte, error) {
+	cmd := exec.Command("gpg", "--batch", "--yes", "--armor", "--detach-sign", "--local-user", key, "--output", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,192 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	finalizeAuto   = "auto"
+	finalizePipe   = "pipe"
+	finalizeConcat = "concat"
+)
+
+func parseFinalizeMethod(s string) (string, error) {
+	switch s {
+	case finalizeAuto:
+		// piping through stdin is slow on windows
+		if runtime.GOOS == "windows" {
+			return finalizeConcat, nil
+		}
+		return finalizePipe, nil
+	case finalizePipe, finalizeConcat:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid finalize method: %s", s)
+}
+
+func concatFiles(output string, files []string, metadata string, subtitle string, opts *options, logger *log.Logger) error {
+	for retry := 0; ; retry++ {
+		stalled, err := runConcat(output, files, metadata, subtitle, opts, logger)
+		if !stalled {
+			return err
+		}
+		if retry >= ffmpegStallRetries {
+			return fmt.Errorf("ffmpeg stalled %d times, giving up", retry+1)
+		}
+		logger.Printf("ffmpeg stalled for %v, retrying\n", opts.ffmpegStallTimeout)
+	}
+}
+
+func runConcat(output string, files []string, metadata string, subtitle string, opts *options, logger *log.Logger) (bool, error) {
+	var args []string
+	if opts.finalizeMethod == finalizeConcat {
+		list := filepath.Join(filepath.Dir(metadata), "concat.txt")
+		if err := writeConcatList(list, files); err != nil {
+			return false, err
+		}
+		defer os.Remove(list)
+		args = append(args, "-f", "concat", "-safe", "0", "-i", list)
+	} else {
+		args = append(args, "-i", "pipe:0")
+	}
+	args = append(args, "-i", metadata)
+	if subtitle != "" {
+		args = append(args,
+			"-i", subtitle,
+			"-map", "0:a",
+			"-map", "2:s",
+		)
+	}
+	args = append(args,
+		"-map_metadata", "1",
+		"-codec", "copy",
+	)
+	if subtitle != "" {
+		args = append(args, "-codec:s", "mov_text")
+	}
+	if opts.replayGain {
+		// keep custom tags such as REPLAYGAIN_TRACK_GAIN in mp4
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+	if opts.preview > 0 {
+		args = append(args, "-t", fmt.Sprintf("%.3f", opts.preview.Seconds()))
+	}
+	args = append(args,
+		"-y",
+		output,
+	)
+
+	// additional transcoded outputs share the single read of segments
+	for _, e := range opts.encodings {
+		args = append(args, "-map_metadata", "1")
+		args = append(args, e.args()...)
+		if opts.replayGain && e.encoder.ext == ".m4a" {
+			args = append(args, "-movflags", "use_metadata_tags")
+		}
+		if opts.preview > 0 {
+			args = append(args, "-t", fmt.Sprintf("%.3f", opts.preview.Seconds()))
+		}
+		args = append(args,
+			"-y",
+			e.output(output),
+		)
+	}
+
+	cmd := opts.ffmpeg.Command(args...)
+	cmd.Stdout = logger.Writer()
+	cmd.Stderr = cmd.Stdout
+
+	logger.Printf("run: %s\n", cmd.String())
+
+	var stdin io.WriteCloser
+	if opts.finalizeMethod != finalizeConcat {
+		var err error
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return false, err
+		}
+	}
+
+	if err := startProcess(cmd, opts.priority, logger); err != nil {
+		return false, err
+	}
+
+	var watchdog *outputWatchdog
+	if opts.ffmpegStallTimeout > 0 {
+		watchdog = startOutputWatchdog(output, opts.ffmpegStallTimeout, func() {
+			cmd.Process.Kill()
+		})
+	}
+
+	var writeErr error
+	if stdin != nil {
+		if writeErr = writeFiles(stdin, files); writeErr != nil {
+			cmd.Process.Kill()
+		}
+	}
+	err := cmd.Wait()
+
+	if watchdog != nil && watchdog.Stop() {
+		return true, err
+	}
+	if writeErr != nil {
+		return false, writeErr
+	}
+	return false, err
+}
+
+func writeFiles(w io.WriteCloser, files []string) error {
+	defer w.Close()
+
+	for _, input := range files {
+		err := func() error {
+			f, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err = io.Copy(w, f); err != nil {
+				return err
+			}
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeConcatList(file string, files []string) error {
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, f := range files {
+		// quote path, a single quote is written as '\''
+		p := strings.ReplaceAll(filepath.ToSlash(f), "'", `'\''`)
+		fmt.Fprintf(&b, "file '%s'\n", p)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
@@ -0,0 +1,232 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+var (
+	indexAudioExts      = []string{".m4a", ".opus", ".mp3"}
+	indexTranscriptExts = []string{".srt", ".vtt", ".chat.jsonl"}
+
+	indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em; text-align: left; vertical-align: top; }
+td.links a { margin-right: 0.8em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Entries}} recordings, generated at {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</p>
+<table>
+<tr><th>Date</th><th>Title</th><th>Host</th><th>Duration</th><th>Files</th></tr>
+{{range .Entries}}<tr>
+<td>{{.Date}}</td>
+<td>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</td>
+<td>{{.Host}}</td>
+<td>{{.Duration}}</td>
+<td class="links">{{range .Files}}<a href="{{.Href}}">{{.Name}}</a>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+)
+
+type indexFile struct {
+	Name string
+	Href string
+}
+
+type indexEntry struct {
+	Date     string
+	Title    string
+	Host     string
+	URL      string
+	Duration string
+	Files    []indexFile
+}
+
+type indexPage struct {
+	Title       string
+	GeneratedAt time.Time
+	Entries     []*indexEntry
+}
+
+func indexCommand(args []string) int {
+	var output string
+	var title string
+	var ffmpegPath string
+	flags := pflag.NewFlagSet("index", pflag.ExitOnError)
+	flags.StringVarP(&output, "output", "o", "", "output html file (default: <root>/index.html)")
+	flags.StringVar(&title, "title", "Spaces", "page title")
+	flags.StringVar(&ffmpegPath, "ffmpeg-path", "", "path to ffmpeg executable used to read durations (default: $"+spacedl.FFmpegPathEnv+" or ffmpeg in PATH)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl index [-o <file>] <root>")
+		return 1
+	}
+	root := filepath.Clean(flags.Arg(0))
+	if output == "" {
+		output = filepath.Join(root, "index.html")
+	}
+
+	// durations are left empty without ffmpeg
+	ffmpeg := spacedl.NewFFmpeg(ffmpegPath)
+	if err := ffmpeg.Check(); err != nil {
+		fmt.Fprintf(os.Stderr, "ffmpeg not available, durations are omitted: %v\n", err)
+		ffmpeg = nil
+	}
+
+	dirs, err := findRecordingDirs(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	page := indexPage{
+		Title:       title,
+		GeneratedAt: time.Now(),
+	}
+	for _, dir := range dirs {
+		entry, err := buildIndexEntry(dir, filepath.Dir(output), ffmpeg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			continue
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+
+	// newest first, directory names start with the date
+	sort.Slice(page.Entries, func(i, j int) bool {
+		return page.Entries[i].Date > page.Entries[j].Date
+	})
+
+	var b bytes.Buffer
+	if err := indexTemplate.Execute(&b, page); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := ioutil.WriteFile(output, b.Bytes(), 0666); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%s: %d recordings\n", output, len(page.Entries))
+
+	return 0
+}
+
+func buildIndexEntry(dir, base string, ffmpeg *spacedl.FFmpeg) (*indexEntry, error) {
+	f, err := os.Open(filepath.Join(dir, MetadataFilename))
+	if err != nil {
+		return nil, err
+	}
+	meta, err := spacedl.ParseMetadata(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &indexEntry{}
+	entry.Title, _ = meta.Get("title")
+	entry.Host, _ = meta.Get("artist")
+	entry.URL, _ = meta.Get("comment")
+	name := filepath.Base(dir)
+	if t, err := time.Parse("20060102-150405", indexDatePrefix(name)); err == nil {
+		entry.Date = t.Format("2006-01-02 15:04")
+	} else {
+		entry.Date, _ = meta.Get("date")
+	}
+
+	var audio []string
+	for _, ext := range indexAudioExts {
+		// output, preview and transcoded copies, split parts
+		for _, pattern := range []string{dir + ext, dir + ".*" + ext, dir + "-[0-9][0-9][0-9]" + ext} {
+			files, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			audio = append(audio, files...)
+		}
+	}
+	sort.Strings(audio)
+
+	var transcripts []string
+	for _, ext := range indexTranscriptExts {
+		if _, err := os.Stat(dir + ext); err == nil {
+			transcripts = append(transcripts, dir+ext)
+		}
+	}
+
+	var total time.Duration
+	if ffmpeg != nil {
+		outputs := []string{dir + ".m4a"}
+		if _, err := os.Stat(outputs[0]); err != nil {
+			outputs, _ = filepath.Glob(dir + "-[0-9][0-9][0-9].m4a")
+		}
+		for _, p := range outputs {
+			if d, err := probeDuration(ffmpeg, processPriority{}, p); err == nil {
+				total += d
+			}
+		}
+	}
+	if total > 0 {
+		entry.Duration = total.Round(time.Second).String()
+	}
+
+	for _, p := range append(audio, transcripts...) {
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return nil, err
+		}
+		entry.Files = append(entry.Files, indexFile{
+			Name: strings.TrimPrefix(filepath.Base(p), filepath.Base(dir)),
+			Href: (&url.URL{Path: filepath.ToSlash(rel)}).String(),
+		})
+	}
+
+	return entry, nil
+}
+
+func indexDatePrefix(name string) string {
+	if len(name) < 15 {
+		return name
+	}
+	return name[:15]
+}
@@ -0,0 +1,126 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+type infoJSONChapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// infoJSON is a subset of the yt-dlp info.json fields
+type infoJSON struct {
+	ID               string            `json:"id"`
+	Title            string            `json:"title"`
+	Uploader         string            `json:"uploader"`
+	UploaderID       string            `json:"uploader_id"`
+	UploaderURL      string            `json:"uploader_url"`
+	Thumbnail        string            `json:"thumbnail,omitempty"`
+	Timestamp        int64             `json:"timestamp"`
+	ReleaseTimestamp int64             `json:"release_timestamp"`
+	UploadDate       string            `json:"upload_date"`
+	Duration         float64           `json:"duration"`
+	LiveStatus       string            `json:"live_status"`
+	WebpageURL       string            `json:"webpage_url"`
+	OriginalURL      string            `json:"original_url"`
+	Extractor        string            `json:"extractor"`
+	ExtractorKey     string            `json:"extractor_key"`
+	Type             string            `json:"_type"`
+	Ext              string            `json:"ext"`
+	Acodec           string            `json:"acodec"`
+	Vcodec           string            `json:"vcodec"`
+	Filename         string            `json:"filename"`
+	LegacyFilename   string            `json:"_filename"`
+	PlaylistIndex    int               `json:"playlist_index,omitempty"`
+	NEntries         int               `json:"n_entries,omitempty"`
+	Chapters         []infoJSONChapter `json:"chapters,omitempty"`
+	Epoch            int64             `json:"epoch"`
+}
+
+// writeInfoJSON writes a yt-dlp compatible <output>.info.json next to each output.
+func writeInfoJSON(spaceID, title string, host *spacedl.User, startedAt time.Time, meta *spacedl.Metadata, outputs []string, opts *options) error {
+	spaceURL := fmt.Sprintf("https://twitter.com/i/spaces/%s", spaceID)
+	for i, output := range outputs {
+		duration, err := probeDuration(opts.ffmpeg, opts.priority, output)
+		if err != nil {
+			return err
+		}
+		p, err := filepath.Abs(output)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(output)
+
+		info := infoJSON{
+			ID:               spaceID,
+			Title:            title,
+			Uploader:         host.DisplayName,
+			UploaderID:       host.TwitterScreenName,
+			UploaderURL:      "https://twitter.com/" + host.TwitterScreenName,
+			Thumbnail:        host.AvatarUrl,
+			Timestamp:        startedAt.Unix(),
+			ReleaseTimestamp: startedAt.Unix(),
+			UploadDate:       startedAt.UTC().Format("20060102"),
+			Duration:         duration.Seconds(),
+			LiveStatus:       "was_live",
+			WebpageURL:       spaceURL,
+			OriginalURL:      spaceURL,
+			Extractor:        "twitter:spaces",
+			ExtractorKey:     "TwitterSpaces",
+			Type:             "video",
+			Ext:              strings.TrimPrefix(ext, "."),
+			Acodec:           "aac",
+			Vcodec:           "none",
+			Filename:         p,
+			LegacyFilename:   p,
+			Epoch:            time.Now().Unix(),
+		}
+		if len(outputs) > 1 {
+			info.PlaylistIndex = i + 1
+			info.NEntries = len(outputs)
+		} else {
+			for _, c := range meta.Chapters() {
+				info.Chapters = append(info.Chapters, infoJSONChapter{
+					StartTime: c.Start.Seconds(),
+					EndTime:   c.End.Seconds(),
+					Title:     c.Title,
+				})
+			}
+		}
+
+		b, err := json.MarshalIndent(&info, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(strings.TrimSuffix(output, ext)+".info.json", b, 0666); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type spaceLock struct {
+	file string
+}
+
+func lockFilename(spaceID string) string {
+	return fmt.Sprintf("space-dl-%s.lock", spaceID)
+}
+
+// acquireLock prevents two processes from recording the same space into the same directory
+func acquireLock(spaceID string) (*spaceLock, error) {
+	file := lockFilename(spaceID)
+
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			_, err = fmt.Fprintln(f, os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(file)
+				return nil, err
+			}
+			return &spaceLock{file: file}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		pid, err := readLockPID(file)
+		if err == nil && processExists(pid) {
+			return nil, fmt.Errorf("space %s is already being recorded by process %d (lock file: %s)", spaceID, pid, file)
+		}
+
+		// stale lock left by a crashed process
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to acquire lock file: %s", file)
+}
+
+func (l *spaceLock) release() error {
+	return os.Remove(l.file)
+}
+
+func readLockPID(file string) (int, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
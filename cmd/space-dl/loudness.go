@@ -0,0 +1,118 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	replayGainReference = -18.0
+	r128Reference       = -23.0
+)
+
+type loudness struct {
+	integrated float64
+	truePeak   float64
+}
+
+func measureLoudness(files []string, opts *options, logger *log.Logger) (*loudness, error) {
+	cmd := opts.ffmpeg.Command("-hide_banner", "-nostats", "-i", "pipe:0", "-af", "loudnorm=print_format=json", "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := startProcess(cmd, opts.priority, logger); err != nil {
+		return nil, err
+	}
+
+	if err := writeFiles(stdin, files); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+
+	// loudnorm prints its measurement as the last json object
+	out := stderr.String()
+	s := strings.LastIndex(out, "{")
+	e := strings.LastIndex(out, "}")
+	if s < 0 || e < s {
+		return nil, errors.New("loudness measurement not found")
+	}
+
+	var m struct {
+		InputI  string `json:"input_i"`
+		InputTP string `json:"input_tp"`
+	}
+	if err := json.Unmarshal([]byte(out[s:e+1]), &m); err != nil {
+		return nil, err
+	}
+
+	integrated, err := strconv.ParseFloat(m.InputI, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integrated loudness: %s", m.InputI)
+	}
+	truePeak, err := strconv.ParseFloat(m.InputTP, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid true peak: %s", m.InputTP)
+	}
+	if math.IsInf(integrated, 0) {
+		return nil, errors.New("audio is silent")
+	}
+
+	return &loudness{
+		integrated: integrated,
+		truePeak:   truePeak,
+	}, nil
+}
+
+func (l *loudness) addTags(meta *spacedl.Metadata) {
+	meta.Add("REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", replayGainReference-l.integrated))
+	meta.Add("REPLAYGAIN_TRACK_PEAK", fmt.Sprintf("%.6f", math.Pow(10, l.truePeak/20)))
+	meta.Add("R128_TRACK_GAIN", strconv.Itoa(int(math.Round((r128Reference-l.integrated)*256))))
+}
+
+func addLoudnessTags(files []string, meta *spacedl.Metadata, opts *options, logger *log.Logger) error {
+	logger.Println("measure loudness")
+
+	l, err := measureLoudness(files, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("loudness: %.1f LUFS, true peak: %.1f dBTP\n", l.integrated, l.truePeak)
+	l.addTags(meta)
+
+	return nil
+}
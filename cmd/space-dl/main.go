@@ -17,14 +17,13 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -33,14 +32,36 @@ import (
 	"github.com/spf13/pflag"
 
 	spacedl "github.com/qitoi/space-dl"
+	"github.com/qitoi/space-dl/sidecar"
 )
 
 const (
 	MetadataFilename = "metadata.txt"
 )
 
+const (
+	exitCodeWaitTimeout = 3
+)
+
+const (
+	minParallel = 1
+	maxParallel = 16
+)
+
+const (
+	waitPollInterval    = 30 * time.Second
+	preRollPollInterval = 2 * time.Second
+	preRollLateWindow   = 10 * time.Minute
+)
+
+const (
+	ffmpegStallRetries = 2
+)
+
 var (
 	errRe = regexp.MustCompile(`^The following (\w+) cannot be null: ([\w, ]+)$`)
+
+	errWaitTimeout = errors.New("timed out waiting for space to start")
 )
 
 func usage() {
@@ -48,59 +69,373 @@ func usage() {
 	e = filepath.Base(e)
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Printf("  %s <space_id>\n", e)
+	fmt.Printf("  %s <space_id|space_url>\n", e)
+	fmt.Printf("  %s --batch-file <file>\n", e)
+	fmt.Printf("  %s --watch-file <file>\n", e)
+	fmt.Printf("  %s refresh <dir|space_id>...\n", e)
+	fmt.Printf("  %s index [-o <file>] <root>\n", e)
+	fmt.Printf("  %s export [--bundle zip] [--gpg-sign <key>] <dir>\n", e)
+	fmt.Printf("  %s rerun <session.yaml>\n", e)
+	fmt.Printf("  %s estimate [--batch-file <file>] <space_id|space_url>...\n", e)
+	fmt.Printf("  %s search [--filter top|live|upcoming] [--ids] <query>...\n", e)
+	fmt.Printf("  %s config init|check [file]\n", e)
+	fmt.Printf("  %s catalog import --download-archive <file> [--yt-dlp-archive <file>] <dir>...\n", e)
+	fmt.Printf("  %s refresh-stats <dir>...\n", e)
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println(pflag.CommandLine.FlagUsages())
 }
 
+type options struct {
+	client        clientOptions
+	wait          bool
+	waitTimeout   time.Duration
+	preview       time.Duration
+	split         time.Duration
+	parallel      int
+	priority      processPriority
+	captions      bool
+	embedCaptions bool
+	chat          bool
+	replayGain    bool
+	cassette      string
+	batchJobs     int
+	archive       *downloadArchive
+	encodings     []encoding
+	ffmpeg        *spacedl.FFmpeg
+	diskWarn      uint64
+	diskStop      uint64
+	location      *time.Location
+
+	ffmpegStallTimeout time.Duration
+	finalizeMethod     string
+	partialInterval    time.Duration
+	summary            string
+	compatInfoJSON     bool
+	paranoid           bool
+	tmpDir             string
+	backfill           *spacedl.Limiter
+	retries            int
+	preRoll            time.Duration
+	retryDelay         time.Duration
+
+	chapters         bool
+	breakMinDuration time.Duration
+	breakNoise       float64
+
+	silenceAlert     time.Duration
+	silenceThreshold float64
+	silenceCommand   string
+
+	announce        string
+	announcePost    bool
+	announceReplyTo string
+}
+
+var (
+	// replaced by a fake clock to drive polling loops without waiting
+	clock = spacedl.SystemClock
+)
+
+var (
+	commands = map[string]func(args []string) int{
+		"catalog":       catalogCommand,
+		"config":        configCommand,
+		"estimate":      estimateCommand,
+		"export":        exportCommand,
+		"index":         indexCommand,
+		"refresh":       refreshCommand,
+		"refresh-stats": refreshStatsCommand,
+		"rerun":         rerunCommand,
+		"search":        searchCommand,
+	}
+)
+
 func main() {
 	var check bool
+	var configFile string
+	var listOps bool
 	var help bool
+	var opts options
+	var ionice string
+	var ffmpegPath string
+	var archiveFile string
+	var alsoEncode []string
+	var batchFile string
+	var watchFile string
+	var watchInterval time.Duration
+	var diskWarn string
+	var diskStop string
+	var timezone string
+	var finalizeMethod string
+	var backfillJobs int
 
 	pflag.BoolVarP(&help, "help", "h", false, "help")
 	pflag.BoolVar(&check, "check", false, "check ffmpeg")
+	pflag.StringVar(&configFile, "config", "", "config file (default: "+ConfigFilename+" in the user config directory if exists)")
+	pflag.BoolVar(&listOps, "list-operations", false, "initialize twitter client and list discovered graphql operations")
+	pflag.StringVar(&batchFile, "batch-file", "", "file containing space ids or urls, one per line (# starts a comment)")
+	pflag.IntVar(&opts.batchJobs, "batch-jobs", 1, "number of spaces in the batch file recorded concurrently")
+	pflag.StringVar(&watchFile, "watch-file", "", "file containing screen names to watch, one per line, their spaces are recorded when they go live")
+	pflag.DurationVar(&watchInterval, "watch-interval", time.Minute, "interval of checking the users in the watch file")
+	pflag.BoolVar(&opts.wait, "wait", false, "wait for scheduled space to start")
+	pflag.DurationVar(&opts.waitTimeout, "wait-timeout", 0, "maximum time to wait for scheduled space to start (implies --wait)")
+	pflag.DurationVar(&opts.preRoll, "pre-roll", 30*time.Second, "start polling frequently for the space to start this long before the scheduled start")
+	pflag.DurationVar(&opts.preview, "preview", 0, "record only the first given duration into a preview file (e.g. 60s)")
+	pflag.DurationVar(&opts.split, "split", 0, "split the output and the --also-encode outputs into files of the given duration (e.g. 1h)")
+	pflag.IntVar(&backfillJobs, "backfill-jobs", 0, "maximum concurrent replay segment downloads shared by all batch jobs, live recordings are not limited (0: no limit)")
+	pflag.IntVar(&opts.parallel, "parallel", 3, fmt.Sprintf("number of parallel segment downloads (%d-%d)", minParallel, maxParallel))
+	pflag.StringSliceVar(&alsoEncode, "also-encode", nil, "also write a transcoded copy, codec[:bitrate] (opus, mp3, aac), e.g. opus:32k")
+	pflag.BoolVar(&opts.replayGain, "replaygain", false, "write replaygain and r128 gain tags")
+	pflag.BoolVar(&opts.chapters, "chapters", false, "write chapters at title changes and breaks")
+	pflag.DurationVar(&opts.breakMinDuration, "break-min-duration", 60*time.Second, "minimum silence duration detected as a break")
+	pflag.Float64Var(&opts.breakNoise, "break-noise", -50, "volume in dB below which audio is treated as a break")
+	pflag.BoolVar(&opts.captions, "captions", false, "save captions as srt and vtt files")
+	pflag.BoolVar(&opts.embedCaptions, "embed-captions", false, "embed captions as subtitle track (implies --captions)")
+	pflag.BoolVar(&opts.chat, "chat", false, "save chat as json lines file")
+	pflag.DurationVar(&opts.silenceAlert, "silence-alert", 0, "warn when live audio has been silent for the given duration (e.g. 5m)")
+	pflag.Float64Var(&opts.silenceThreshold, "silence-threshold", -50, "mean volume in dB below which audio is treated as silence")
+	pflag.StringVar(&opts.silenceCommand, "silence-command", "", "command to run on silence alert")
+	pflag.StringVar(&diskWarn, "disk-warn-space", "2G", "warn when free disk space falls below the size (0 disables)")
+	pflag.StringVar(&diskStop, "disk-stop-space", "200M", "stop recording and finalize when free disk space falls below the size (0 disables)")
+	pflag.StringVar(&archiveFile, "download-archive", "", "skip spaces listed in the file, and record the ids of downloaded spaces to it")
+	pflag.IntVar(&opts.retries, "retries", 3, "number of retries on transient errors while resolving the space and stream url")
+	pflag.DurationVar(&opts.retryDelay, "retry-delay", 10*time.Second, "delay between retries")
+	pflag.StringVar(&opts.tmpDir, "tmp-dir", "", "write segments to the scratch directory, only outputs and sidecar files are written to the output directory")
+	pflag.BoolVar(&opts.paranoid, "paranoid", false, "download replays twice and verify that every segment matches")
+	pflag.BoolVar(&opts.compatInfoJSON, "compat-info-json", false, "write yt-dlp compatible .info.json next to the outputs")
+	pflag.StringVar(&opts.summary, "summary-json", "", "append a json summary line of each recording to the file (- for stdout)")
+	pflag.StringVar(&opts.cassette, "cassette", "", "record network interactions to file, or replay them if file exists")
+	pflag.StringVar(&opts.announce, "announce", "", "draft an announcement of the finished recording to "+AnnounceFilename+", {title}, {host}, {space_id}, {space_url} and {dir} are replaced, e.g. \"Archive of {title}: https://example.com/{dir}/\"")
+	pflag.BoolVar(&opts.announcePost, "announce-post", false, "post the announcement from the logged in session instead of drafting it")
+	pflag.StringVar(&opts.announceReplyTo, "announce-reply-to", "", "post the announcement as a reply to the tweet id")
+	pflag.StringVar(&timezone, "timezone", "", "timezone of directory names and date tags, e.g. UTC, Asia/Tokyo (default: local timezone)")
+	pflag.DurationVar(&opts.partialInterval, "partial-interval", 0, "write playable partial outputs of a live recording at the interval (e.g. 10m)")
+	pflag.StringVar(&finalizeMethod, "finalize-method", finalizeAuto, "how segments are passed to ffmpeg: pipe, concat (list file) or auto (concat on windows)")
+	pflag.DurationVar(&opts.ffmpegStallTimeout, "ffmpeg-stall-timeout", 5*time.Minute, "kill and retry ffmpeg when the output does not grow for the duration (0 disables)")
+	pflag.StringVar(&ffmpegPath, "ffmpeg-path", "", "path to ffmpeg executable (default: $"+spacedl.FFmpegPathEnv+" or ffmpeg in PATH)")
+	addClientFlags(pflag.CommandLine, &opts.client)
+	pflag.IntVar(&opts.priority.nice, "nice", 0, "niceness of ffmpeg process")
+	pflag.StringVar(&ionice, "ionice", "", "io scheduling class of ffmpeg process (linux only): idle, best-effort[:0-7], realtime[:0-7]")
+
+	// subcommands, config uses the flags defined above
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
 
 	pflag.Parse()
 
+	if configFile == "" {
+		if file := defaultConfigFile(); file != "" {
+			if _, err := os.Stat(file); err == nil {
+				configFile = file
+			}
+		}
+	}
+	if configFile != "" {
+		if err := applyConfig(pflag.CommandLine, configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	opts.ffmpeg = spacedl.NewFFmpeg(ffmpegPath)
+	if archiveFile != "" {
+		opts.archive = newDownloadArchive(archiveFile)
+	}
+
 	if help {
 		usage()
 		os.Exit(0)
 	} else if check {
-		if err := spacedl.CheckFFmpeg(); err != nil {
+		if err := opts.ffmpeg.Check(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("OK: ffmpeg installed (%s)\n", opts.ffmpeg.Path)
+		if err := printCapabilities(&opts); err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println("OK: ffmpeg installed")
 		os.Exit(0)
-	} else if pflag.NArg() != 1 {
+	} else if listOps {
+		if err := listOperations(&opts.client); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	} else if watchFile != "" && (batchFile != "" || pflag.NArg() != 0 || opts.cassette != "") {
+		fmt.Fprintln(os.Stderr, "invalid arguments: --watch-file cannot be used with spaces, --batch-file or --cassette")
+		usage()
+		os.Exit(1)
+	} else if (batchFile == "" && watchFile == "" && pflag.NArg() != 1) || opts.batchJobs < 1 {
 		fmt.Fprintln(os.Stderr, "invalid arguments")
 		usage()
 		os.Exit(1)
 	}
 
-	spaceID := os.Args[1]
+	if backfillJobs < 0 {
+		fmt.Fprintf(os.Stderr, "invalid backfill jobs: %d\n", backfillJobs)
+		os.Exit(1)
+	} else if backfillJobs > 0 {
+		opts.backfill = spacedl.NewLimiter(backfillJobs)
+	}
+
+	if (opts.announcePost || opts.announceReplyTo != "") && opts.announce == "" {
+		fmt.Fprintln(os.Stderr, "--announce-post and --announce-reply-to require --announce")
+		os.Exit(1)
+	}
+
+	if opts.retries < 0 {
+		fmt.Fprintf(os.Stderr, "invalid retries: %d\n", opts.retries)
+		os.Exit(1)
+	}
+
+	if opts.parallel < minParallel || opts.parallel > maxParallel {
+		fmt.Fprintf(os.Stderr, "invalid parallel: %d (must be %d-%d)\n", opts.parallel, minParallel, maxParallel)
+		os.Exit(1)
+	}
+
+	for _, s := range alsoEncode {
+		e, err := parseEncoding(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.encodings = append(opts.encodings, e)
+	}
+
+	var err error
+	if opts.diskWarn, err = parseSize(diskWarn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if opts.diskStop, err = parseSize(diskStop); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if opts.finalizeMethod, err = parseFinalizeMethod(finalizeMethod); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if opts.location, err = loadTimezone(timezone); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := opts.priority.parseIOClass(ionice); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if watchFile != "" {
+		if watchInterval <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid watch interval: %s\n", watchInterval)
+			os.Exit(1)
+		}
+		// a broken watch file fails at start instead of at every poll
+		if _, err := readWatchFile(watchFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := checkCapabilities(&opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		handleSignals()
+		startSdWatchdog()
+		sdNotify("READY=1")
+
+		os.Exit(runWatch(watchFile, watchInterval, &opts))
+	}
+
+	var spaceIDs []string
+	for _, arg := range pflag.Args() {
+		spaceID, err := spacedl.ParseSpaceID(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		spaceIDs = append(spaceIDs, spaceID)
+	}
 
-	if err := run(spaceID); err != nil {
+	if batchFile != "" {
+		ids, err := readBatchFile(batchFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		spaceIDs = append(spaceIDs, ids...)
+	}
+
+	if len(spaceIDs) == 0 {
+		fmt.Fprintln(os.Stderr, "no spaces to record")
+		os.Exit(1)
+	}
+
+	if err := checkCapabilities(&opts); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+
+	handleSignals()
+	startSdWatchdog()
+	sdNotify("READY=1")
+
+	os.Exit(runAll(spaceIDs, &opts))
 }
 
-func run(spaceID string) error {
-	client, _ := spacedl.NewClient()
-	if err := client.Initialize(); err != nil {
+func run(spaceID string, opts *options) error {
+	if opts.archive != nil {
+		archived, err := opts.archive.contains(spaceID)
+		if err != nil {
+			return err
+		}
+		if archived {
+			fmt.Printf("%s: already recorded in download archive\n", spaceID)
+			return nil
+		}
+	}
+
+	lock, err := acquireLock(spaceID)
+	if err != nil {
 		return err
 	}
+	defer lock.release()
+
+	// retries are not waited after shutdown
+	ctx, cancel := shutdownContext()
+	defer cancel()
 
+	var client *spacedl.Client
+	var resp *spacedl.AudioSpaceByIDResponse
 	params := buildAudioSpaceInfoParams(spaceID)
 
-	resp, params, err := getAudioSpaceInfo(client, params)
+	err = withRetry(ctx, opts, printStderr, func() error {
+		var err error
+		if client, err = newClient(&opts.client); err != nil {
+			return err
+		}
+		resp, params, err = getAudioSpaceInfo(client, params)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	if !isSpaceAvailable(resp) {
-		return errors.New("space is not available")
+	if resp.IsScheduled() && (opts.wait || opts.waitTimeout > 0) {
+		sdStatus(fmt.Sprintf("waiting for %s to start", spaceID))
+		resp, params, err = waitSpaceStart(client, params, resp, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := client.CheckAccess(resp); err != nil {
+		return err
 	}
 
 	u := spacedl.GetOwnerUser(resp)
@@ -109,63 +444,285 @@ func run(spaceID string) error {
 	}
 
 	startedAtUnix := resp.Data.AudioSpace.Metadata.StartedAt
-	startedAt := time.Unix(startedAtUnix/1000, startedAtUnix%1000*1000000)
-	dir := fmt.Sprintf("%s-%s", startedAt.Local().Format("20060102-150405"), u.TwitterScreenName)
+	startedAt := time.Unix(startedAtUnix/1000, startedAtUnix%1000*1000000).In(opts.location)
+	dir := recordingDirName(startedAt, u.TwitterScreenName)
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return err
 	}
 
+	if err := checkDiskSpace(dir, opts); err != nil {
+		return err
+	}
+
+	// segments are written to the scratch directory if given
+	segDir := dir
+	if opts.tmpDir != "" {
+		segDir = filepath.Join(opts.tmpDir, filepath.Base(dir))
+		if err := os.MkdirAll(segDir, 0777); err != nil {
+			return err
+		}
+		if err := checkDiskSpace(segDir, opts); err != nil {
+			return err
+		}
+	}
+
 	// create log
 	logfile, err := os.Create(filepath.Join(dir, "space-dl.log"))
 	if err != nil {
 		return err
 	}
+	defer logfile.Close()
 	lw := io.MultiWriter(os.Stdout, logfile)
 	logger := log.New(lw, "", log.LstdFlags)
 
+	// save session
+	if err := saveSession(filepath.Join(dir, SessionFilename), spaceID, pflag.CommandLine); err != nil {
+		logger.Printf("session error: %v\n", err)
+	}
+
 	// save metadata
 	metadata := filepath.Join(dir, MetadataFilename)
 	title := resp.Data.AudioSpace.Metadata.Title
-	if err := saveMetadata(metadata, spaceID, title, u.DisplayName, startedAt); err != nil {
+	meta := buildMetadata(spaceID, title, u.DisplayName, startedAt)
+	if err := saveMetadata(metadata, meta); err != nil {
 		return err
 	}
 
 	mediaKey := resp.Data.AudioSpace.Metadata.MediaKey
-	streamURL, err := getStreamURL(client, mediaKey)
+	var stream *spacedl.LiveVideoStreamResponse
+	err = withRetry(ctx, opts, logger.Printf, func() error {
+		stream, err = getLiveVideoStream(client, mediaKey)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	streamURL := stream.Source.Location
 
 	logger.Printf("stream url: %s\n", streamURL)
+	if loc, err := stream.StreamLocation(); err == nil && loc.Region != "" {
+		logger.Printf("stream region: %s\n", loc.Region)
+	}
+
+	// save participants
+	participants := newParticipantTracker(filepath.Join(dir, ParticipantsFilename))
+	participants.update(resp, time.Now())
+	if err := participants.save(); err != nil {
+		logger.Printf("participants error: %v\n", err)
+	}
+
+	// save stats
+	statsFile := filepath.Join(dir, StatsFilename)
+	stats := &sidecar.Stats{SpaceID: spaceID}
+	sampleStats(stats, resp, time.Now())
+	if err := saveStats(statsFile, stats); err != nil {
+		logger.Printf("stats error: %v\n", err)
+	}
+
+	// access chat
+	var chat *chatRecorder
+	if opts.chat || opts.captions || opts.embedCaptions {
+		chatFile := ""
+		if opts.chat {
+			chatFile = dir + ".chat.jsonl"
+		}
+		chat, err = newChatRecorder(client, stream.ChatToken, chatFile, logger)
+		if err != nil {
+			logger.Printf("chat error: %v\n", err)
+			chat = nil
+		} else {
+			defer chat.Close()
+		}
+	}
 
 	// download stream
-	if err := download(client, params, streamURL, dir, logger); err != nil {
-		return err
+	sdStatus(fmt.Sprintf("recording %s", spaceID))
+	recordStartedAt := startedAt
+	var titles *chapterTracker
+	var missing []uint64
+	if opts.paranoid && !isSpaceEnded(resp) {
+		logger.Println("--paranoid is only supported for replays")
+	}
+	if isSpaceEnded(resp) {
+		if missing, err = downloadReplay(streamURL, segDir, dir, opts, logger); err != nil {
+			return err
+		}
+	} else {
+		if now := time.Now(); now.After(recordStartedAt) {
+			recordStartedAt = now
+		}
+		stopChat := func() {}
+		if chat != nil {
+			stopChat = chat.start(chatPollInterval)
+		}
+		stopSilence := func() {}
+		if opts.silenceAlert > 0 {
+			stopSilence = newSilenceMonitor(spaceID, segDir, opts, logger).start(silenceCheckInterval)
+		}
+		stopPartial := func() {}
+		if opts.partialInterval > 0 {
+			stopPartial = newPartialWriter(segDir, dir, opts, logger).start(opts.partialInterval)
+		}
+		titles = newChapterTracker(title, recordStartedAt)
+		onUpdate := func(resp *spacedl.AudioSpaceByIDResponse) {
+			now := time.Now()
+			participants.update(resp, now)
+			if err := participants.save(); err != nil {
+				logger.Printf("participants error: %v\n", err)
+			}
+			titles.update(resp.Data.AudioSpace.Metadata.Title, now)
+			sampleStats(stats, resp, now)
+			if err := saveStats(statsFile, stats); err != nil {
+				logger.Printf("stats error: %v\n", err)
+			}
+		}
+		onTakedown := func(now time.Time) {
+			stats.TakenDownAt = &now
+			if err := saveStats(statsFile, stats); err != nil {
+				logger.Printf("stats error: %v\n", err)
+			}
+		}
+		missing, err = download(client, params, streamURL, segDir, dir, onUpdate, onTakedown, opts, logger)
+		stopPartial()
+		stopSilence()
+		stopChat()
+		if err != nil {
+			return err
+		}
 	}
 
-	files, err := getSegmentFilePaths(dir)
+	sdStatus(fmt.Sprintf("finalizing %s", spaceID))
+
+	// save chat and captions
+	output := dir + ".m4a"
+	if opts.preview > 0 {
+		output = dir + ".preview.m4a"
+	}
+	subtitle := ""
+	if chat != nil {
+		if err := chat.poll(); err != nil {
+			logger.Printf("chat error: %v\n", err)
+		}
+
+		if opts.captions || opts.embedCaptions {
+			srt, err := saveCaptions(chat.Messages(), recordStartedAt, dir, logger)
+			if err != nil {
+				logger.Printf("caption error: %v\n", err)
+			} else if opts.embedCaptions {
+				subtitle = srt
+			}
+		}
+	}
+
+	files, err := getSegmentFilePaths(segDir)
 	if err != nil {
 		return err
 	}
 
+	// the segments are kept in the scratch directory if the output cannot be written
+	if err := checkFinalizeSpace(dir, files, opts); err != nil {
+		return err
+	}
+
+	// detect chapters
+	if opts.chapters {
+		if err := addChapters(files, meta, title, titles, opts, logger); err != nil {
+			logger.Printf("chapter error: %v\n", err)
+		} else if err := saveMetadata(metadata, meta); err != nil {
+			return err
+		}
+	}
+
+	// compute replaygain
+	if opts.replayGain {
+		if err := addLoudnessTags(files, meta, opts, logger); err != nil {
+			logger.Printf("replaygain error: %v\n", err)
+		} else if err := saveMetadata(metadata, meta); err != nil {
+			return err
+		}
+	}
+
 	// concatenate media files
-	output := dir + ".m4a"
-	if err := concatFiles(output, files, metadata, logger); err != nil {
+	if err := concatFiles(output, files, metadata, subtitle, opts, logger); err != nil {
 		return fmt.Errorf("ffmpeg error: %w", err)
 	}
 
+	// partial outputs are no longer needed
+	if err := removePartials(dir); err != nil {
+		logger.Printf("partial output error: %v\n", err)
+	}
+
+	// split output
+	outputs := []string{output}
+	if opts.split > 0 {
+		if outputs, err = splitOutput(output, meta, dir, opts, logger); err != nil {
+			return fmt.Errorf("split error: %w", err)
+		}
+		// the additional encodings are split into the same parts
+		for _, e := range opts.encodings {
+			if _, err := splitOutput(e.output(output), meta, dir, opts, logger); err != nil {
+				return fmt.Errorf("split error: %w", err)
+			}
+		}
+	}
+
+	if segDir != dir {
+		if err := os.RemoveAll(segDir); err != nil {
+			logger.Printf("remove scratch directory error: %v\n", err)
+		}
+	}
+
+	if opts.compatInfoJSON {
+		if err := writeInfoJSON(spaceID, title, u, startedAt, meta, outputs, opts); err != nil {
+			logger.Printf("info.json error: %v\n", err)
+		}
+	}
+
+	if opts.archive != nil && opts.preview == 0 {
+		if err := opts.archive.add(spaceID); err != nil {
+			return err
+		}
+	}
+
+	if opts.announce != "" && opts.preview == 0 {
+		if err := announce(spaceID, title, u, dir, opts, logger); err != nil {
+			logger.Printf("announce error: %v\n", err)
+		}
+	}
+
+	if opts.summary != "" {
+		summary, err := buildSummary(spaceID, title, u, files, missing, outputs, opts)
+		if err != nil {
+			logger.Printf("summary error: %v\n", err)
+		} else if err := writeSummary(opts.summary, summary); err != nil {
+			logger.Printf("summary error: %v\n", err)
+		}
+	}
+
 	logger.Println("done")
 
 	return nil
 }
 
-func saveMetadata(file string, spaceID, title, name string, startedAt time.Time) error {
+func openCassette(file string) (*spacedl.Cassette, error) {
+	if _, err := os.Stat(file); err == nil {
+		fmt.Printf("replay cassette: %s\n", file)
+		return spacedl.LoadCassette(file)
+	}
+	fmt.Printf("record cassette: %s\n", file)
+	return spacedl.NewRecordingCassette(file, nil)
+}
+
+func buildMetadata(spaceID, title, name string, startedAt time.Time) *spacedl.Metadata {
 	var meta spacedl.Metadata
 	meta.Add("title", title)
 	meta.Add("artist", name)
-	meta.Add("date", startedAt.Local().Format("2006"))
+	meta.Add("date", startedAt.Format("2006"))
 	meta.Add("comment", fmt.Sprintf("https://twitter.com/i/spaces/%s", spaceID))
+	return &meta
+}
 
+func saveMetadata(file string, meta *spacedl.Metadata) error {
 	f, err := os.Create(file)
 	if err != nil {
 		return err
@@ -179,154 +736,208 @@ func saveMetadata(file string, spaceID, title, name string, startedAt time.Time)
 	return nil
 }
 
-func getStreamURL(client *spacedl.Client, mediaKey string) (string, error) {
-	streamURL, err := client.GetStreamURL(mediaKey)
+func getLiveVideoStream(client *spacedl.Client, mediaKey string) (*spacedl.LiveVideoStreamResponse, error) {
+	stream, err := client.GetLiveVideoStream(mediaKey)
 	if err != nil {
-		return "", fmt.Errorf("stream url not found: %w", err)
+		return nil, fmt.Errorf("stream url not found: %w", err)
 	}
-	return streamURL, nil
+	if stream.Source.Location == "" {
+		return nil, errors.New("stream url not found")
+	}
+	return stream, nil
 }
 
-func download(client *spacedl.Client, params []spacedl.QueryParameter, streamURL, dir string, logger *log.Logger) error {
+func download(client *spacedl.Client, params []spacedl.QueryParameter, streamURL, dir, outDir string, onUpdate func(*spacedl.AudioSpaceByIDResponse), onTakedown func(time.Time), opts *options, logger *log.Logger) ([]uint64, error) {
 	dl := spacedl.NewDownloader(streamURL, dir)
+	dl.HTTPClient = opts.client.downloaderHTTPClient()
 	dl.Logger = logger
+	dl.Hooks = traceHooks(opts.client.traceRequests, logger)
+	dl.Parallel = opts.parallel
+	dl.UserAgent = opts.client.userAgent
+	dl.MaxDuration = opts.preview
+	dl.Clock = clock
+
+	stopGuard := startDiskGuard(guardDirs(dir, outDir), opts, logger, dl.Halt)
+	defer stopGuard()
 
 	dl.Start(1 * time.Second)
 
-	ticker := time.NewTicker(10 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshots := client.WatchSpaceFunc(ctx, 10*time.Second, func(ctx context.Context) (*spacedl.AudioSpaceByIDResponse, error) {
+		resp, newParams, err := getAudioSpaceInfo(client, params)
+		if err == nil {
+			params = newParams
+		}
+		return resp, err
+	})
+	takenDown := false
+	stop := shutdown
 
 	for {
 		select {
-		case <-ticker.C:
-			resp, newParams, err := getAudioSpaceInfo(client, params)
-			if err != nil {
-				logger.Printf("space info error: %v\n", err)
+		case <-stop:
+			stop = nil
+			cancel()
+			dl.Halt()
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				snapshots = nil
 				continue
 			}
-			params = newParams
-			if isSpaceEnded(resp) {
-				ticker.Stop()
+			if snapshot.TakenDown {
+				// the stream may still be served, keep downloading until the playlist dies
+				if !takenDown {
+					takenDown = true
+					logger.Printf("space was deleted or the host account was suspended, continue downloading until the stream ends\n")
+					onTakedown(snapshot.Time)
+				}
+				continue
+			}
+			if snapshot.Err != nil {
+				logger.Printf("space info error: %v\n", snapshot.Err)
+				continue
+			}
+
+			onUpdate(snapshot.Info.Raw)
+
+			if snapshot.Ended {
+				if status := snapshot.Info.Status; status != spacedl.SpaceStatusEnded {
+					logger.Printf("space %s, finalizing the recording\n", status)
+				}
 				dl.Halt()
 			}
 		case <-dl.Done:
-			return nil
+			return dl.Missing(), nil
 		}
 	}
 }
 
-func getSegmentFilePaths(dir string) ([]string, error) {
-	fis, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return nil, err
+func waitSpaceStart(client *spacedl.Client, params []spacedl.QueryParameter, resp *spacedl.AudioSpaceByIDResponse, opts *options) (*spacedl.AudioSpaceByIDResponse, []spacedl.QueryParameter, error) {
+	var deadline <-chan time.Time
+	if opts.waitTimeout > 0 {
+		timer := clock.NewTimer(opts.waitTimeout)
+		defer timer.Stop()
+		deadline = timer.C()
 	}
 
-	var files []string
-	for _, fi := range fis {
-		if filepath.Ext(fi.Name()) != ".aac" {
-			continue
+	scheduledStart := resp.ScheduledStart()
+	if !scheduledStart.IsZero() {
+		scheduledStart = scheduledStart.In(opts.location)
+		fmt.Printf("waiting for space to start (scheduled at %s)\n", scheduledStart.Format("2006-01-02 15:04:05 MST"))
+	} else {
+		fmt.Println("waiting for space to start")
+	}
+
+	for {
+		interval := waitPollInterval
+		if !scheduledStart.IsZero() {
+			now := clock.Now()
+			remaining := scheduledStart.Sub(now)
+			// poll frequently around the scheduled start so the beginning is not missed
+			if remaining <= opts.preRoll && remaining > -preRollLateWindow {
+				interval = preRollPollInterval
+			} else if remaining > opts.preRoll {
+				fmt.Printf("starts in %v\n", remaining.Round(time.Second))
+				if remaining-opts.preRoll < interval {
+					interval = remaining - opts.preRoll
+				}
+			}
 		}
 
-		p, err := filepath.Abs(filepath.Join(dir, fi.Name()))
-		if err != nil {
-			return nil, err
+		timer := clock.NewTimer(interval)
+		select {
+		case <-shutdown:
+			timer.Stop()
+			return nil, nil, errShutdown
+		case <-deadline:
+			timer.Stop()
+			return nil, nil, errWaitTimeout
+		case <-timer.C():
+			resp, newParams, err := getAudioSpaceInfo(client, params)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "space info error: %v\n", err)
+				continue
+			}
+			params = newParams
+			if !resp.IsScheduled() {
+				return resp, params, nil
+			}
 		}
-		files = append(files, p)
 	}
-
-	return files, nil
 }
 
-func concatFiles(output string, files []string, metadata string, logger *log.Logger) error {
-	opts := []string{
-		"-i", "pipe:0",
-		"-i", metadata,
-		"-map_metadata", "1",
-		"-codec", "copy",
-		"-y",
-		output,
+func downloadReplay(streamURL, segDir, dir string, opts *options, logger *log.Logger) ([]uint64, error) {
+	dl := spacedl.NewDownloader(streamURL, segDir)
+	dl.HTTPClient = opts.client.downloaderHTTPClient()
+	dl.Logger = logger
+	dl.Hooks = traceHooks(opts.client.traceRequests, logger)
+	dl.Parallel = opts.parallel
+	dl.BackfillLimiter = opts.backfill
+	dl.UserAgent = opts.client.userAgent
+	dl.MaxDuration = opts.preview
+
+	var hashes *segmentHashes
+	if opts.paranoid {
+		hashes = newSegmentHashes()
+		dl.AddFilter(func(seq uint64, data []byte) ([]byte, bool) {
+			hashes.add(seq, data)
+			return data, true
+		})
 	}
-	cmd := exec.Command("ffmpeg", opts...)
-	cmd.Stdout = logger.Writer()
-	cmd.Stderr = cmd.Stdout
 
-	logger.Printf("run: %s\n", cmd.String())
+	stopGuard := startDiskGuard(guardDirs(segDir, dir), opts, logger, dl.Halt)
+	defer stopGuard()
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return err
+	logger.Println("download replay")
+
+	// a halt before the download starts would be dropped, the context is checked for the whole download
+	ctx, cancel := shutdownContext()
+	defer cancel()
+
+	// the segments downloaded until the shutdown or the disk guard are finalized
+	if err := dl.DownloadContext(ctx); err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, spacedl.ErrHalted) {
+		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
-		return err
+	// mismatches are flagged in the log and the verification file, the first download is kept
+	if opts.paranoid && !isShuttingDown() {
+		if _, err := verifyReplay(streamURL, dir, hashes, opts, logger); err != nil {
+			logger.Printf("verification error: %v\n", err)
+		}
 	}
 
-	ch := make(chan error)
+	return dl.Missing(), nil
+}
 
-	go func() {
-		defer stdin.Close()
-		defer close(ch)
+func getSegmentFilePaths(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, input := range files {
-			err := func() error {
-				f, err := os.Open(input)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				if _, err = io.Copy(stdin, f); err != nil {
-					return err
-				}
-				return nil
-			}()
-			if err != nil {
-				ch <- err
-				return
-			}
+	var files []string
+	for _, fi := range fis {
+		if filepath.Ext(fi.Name()) != ".aac" {
+			continue
 		}
-	}()
 
-	for err := range ch {
+		p, err := filepath.Abs(filepath.Join(dir, fi.Name()))
 		if err != nil {
-			cmd.Process.Kill()
-			return err
+			return nil, err
 		}
+		files = append(files, p)
 	}
 
-	return cmd.Wait()
-}
-
-func isSpaceAvailable(resp *spacedl.AudioSpaceByIDResponse) bool {
-	return resp.Data.AudioSpace.Metadata.State == "Running" || resp.Data.AudioSpace.Metadata.State == "Ended"
+	return files, nil
 }
 
 func isSpaceEnded(resp *spacedl.AudioSpaceByIDResponse) bool {
-	return resp.Data.AudioSpace.Metadata.State == "Ended"
+	return resp.Status().IsFinal()
 }
 
 func buildAudioSpaceInfoParams(spaceID string) []spacedl.QueryParameter {
-	var params []spacedl.QueryParameter
-
-	variables := spacedl.AudioSpaceByIDVariables{
-		ID: spaceID,
-	}
-	v, _ := json.Marshal(variables)
-	var vv map[string]interface{}
-	json.Unmarshal(v, &vv)
-	params = append(params, spacedl.QueryParameter{
-		Name:  "variables",
-		Value: vv,
-	})
-
-	features := spacedl.AudioSpaceByIDFeatures{}
-	f, _ := json.Marshal(features)
-	var ff map[string]interface{}
-	json.Unmarshal(f, &ff)
-	params = append(params, spacedl.QueryParameter{
-		Name:  "features",
-		Value: ff,
-	})
-
-	return params
+	return spacedl.AudioSpaceByIDParams(spaceID)
 }
 
 func getAudioSpaceInfo(client *spacedl.Client, params []spacedl.QueryParameter) (*spacedl.AudioSpaceByIDResponse, []spacedl.QueryParameter, error) {
@@ -0,0 +1,89 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func listOperations(opts *clientOptions) error {
+	// the same options as the recordings, the operations may differ by the host and the session.
+	// the token cache is not used to show what is discovered now
+	clientOpts := *opts
+	clientOpts.tokenCache = ""
+	client, err := buildClient(&clientOpts)
+	if err != nil {
+		return err
+	}
+
+	// print what was discovered even if initialization failed halfway
+	initErr := initializeClient(client, &clientOpts)
+
+	// the fallback is not discovered, label it not to be taken as the current values
+	fallbackErr := client.FallbackErr()
+	label := ""
+	if fallbackErr != nil {
+		label = " (FALLBACK)"
+		fmt.Printf("FALLBACK: %v, the built-in bearer token and operations are shown\n\n", fallbackErr)
+	}
+
+	fmt.Printf("main js:      %s\n", valueOrNone(client.MainJsURL()))
+	fmt.Printf("api js:       %s\n", valueOrNone(client.ApiJsURL()))
+	fmt.Printf("bearer token: %s%s\n", valueOrNone(maskToken(client.BearerToken())), label)
+	if client.GuestToken() != "" {
+		fmt.Printf("guest token:  ok\n")
+	} else {
+		fmt.Printf("guest token:  none\n")
+	}
+
+	operations := client.Operations()
+	fmt.Printf("operations:   %d%s\n", len(operations), label)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tQUERY ID")
+	for _, op := range operations {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", op.OperationName, op.OperationType, op.QueryID)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if initErr != nil {
+		return initErr
+	}
+	if fallbackErr != nil && !opts.offlineInit {
+		return fmt.Errorf("discovery failed: %w", fallbackErr)
+	}
+	return nil
+}
+
+func maskToken(token string) string {
+	if len(token) <= 12 {
+		return token
+	}
+	return token[:8] + "..." + token[len(token)-4:]
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
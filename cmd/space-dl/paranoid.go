@@ -0,0 +1,125 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	VerificationFilename = "verification.json"
+)
+
+type segmentHashes struct {
+	mu     sync.Mutex
+	hashes map[uint64]string
+}
+
+func newSegmentHashes() *segmentHashes {
+	return &segmentHashes{
+		hashes: make(map[uint64]string),
+	}
+}
+
+func (h *segmentHashes) add(seq uint64, data []byte) {
+	sum := sha256.Sum256(data)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hashes[seq] = hex.EncodeToString(sum[:])
+}
+
+type verificationMismatch struct {
+	Seq    uint64 `json:"seq"`
+	First  string `json:"first"`
+	Second string `json:"second"`
+}
+
+type verificationResult struct {
+	Segments   int                    `json:"segments"`
+	Mismatches []verificationMismatch `json:"mismatches"`
+}
+
+// verifyReplay downloads the replay again without writing segments, and compares hashes of each segment
+func verifyReplay(streamURL, dir string, first *segmentHashes, opts *options, logger *log.Logger) (*verificationResult, error) {
+	second := newSegmentHashes()
+
+	// segments are dropped by the filter, nothing is written to the directory
+	dl := spacedl.NewDownloader(streamURL, dir)
+	dl.HTTPClient = opts.client.downloaderHTTPClient()
+	dl.Parallel = opts.parallel
+	dl.UserAgent = opts.client.userAgent
+	dl.MaxDuration = opts.preview
+	dl.Hooks = traceHooks(opts.client.traceRequests, logger)
+	dl.AddFilter(func(seq uint64, data []byte) ([]byte, bool) {
+		second.add(seq, data)
+		return nil, false
+	})
+
+	logger.Println("download replay again for verification")
+
+	if err := dl.Download(); err != nil {
+		return nil, err
+	}
+
+	result := &verificationResult{
+		Segments:   len(first.hashes),
+		Mismatches: []verificationMismatch{},
+	}
+	seqs := make(map[uint64]bool)
+	for seq := range first.hashes {
+		seqs[seq] = true
+	}
+	for seq := range second.hashes {
+		seqs[seq] = true
+	}
+	for seq := range seqs {
+		if first.hashes[seq] != second.hashes[seq] {
+			result.Mismatches = append(result.Mismatches, verificationMismatch{
+				Seq:    seq,
+				First:  first.hashes[seq],
+				Second: second.hashes[seq],
+			})
+		}
+	}
+	sort.Slice(result.Mismatches, func(i, j int) bool {
+		return result.Mismatches[i].Seq < result.Mismatches[j].Seq
+	})
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, VerificationFilename), b, 0666); err != nil {
+		return nil, err
+	}
+
+	for _, m := range result.Mismatches {
+		logger.Printf("verification mismatch: seq %d (%s, %s)\n", m.Seq, m.First, m.Second)
+	}
+	logger.Printf("verification: %d segments, %d mismatches\n", result.Segments, len(result.Mismatches))
+
+	return result, nil
+}
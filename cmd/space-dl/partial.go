@@ -0,0 +1,148 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	// segments modified recently may still be being written
+	partialSettleTime = 5 * time.Second
+)
+
+type partialWriter struct {
+	ffmpeg   *spacedl.FFmpeg
+	priority processPriority
+	dir      string
+	outDir   string
+	logger   *log.Logger
+
+	written map[string]bool
+	count   int
+}
+
+func newPartialWriter(dir, outDir string, opts *options, logger *log.Logger) *partialWriter {
+	return &partialWriter{
+		ffmpeg:   opts.ffmpeg,
+		priority: opts.priority,
+		dir:      dir,
+		outDir:   outDir,
+		logger:   logger,
+		written:  make(map[string]bool),
+	}
+}
+
+func (p *partialWriter) start(interval time.Duration) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C():
+				if err := p.flush(now); err != nil {
+					p.logger.Printf("partial output error: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (p *partialWriter) flush(now time.Time) error {
+	fis, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if filepath.Ext(name) != ".aac" || p.written[name] || now.Sub(fi.ModTime()) < partialSettleTime {
+			continue
+		}
+		files = append(files, filepath.Join(p.dir, name))
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	output := filepath.Join(p.outDir, fmt.Sprintf("partial-%04d.m4a", p.count+1))
+	cmd := p.ffmpeg.Command("-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-codec", "copy", "-y", output)
+	cmd.Stdout = p.logger.Writer()
+	cmd.Stderr = cmd.Stdout
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := startProcess(cmd, p.priority, p.logger); err != nil {
+		return err
+	}
+
+	if err := writeFiles(stdin, files); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	for _, f := range files {
+		p.written[filepath.Base(f)] = true
+	}
+	p.count += 1
+	p.logger.Printf("partial output: %s (%d segments)\n", output, len(files))
+
+	return nil
+}
+
+func removePartials(dir string) error {
+	partials, err := filepath.Glob(filepath.Join(dir, "partial-[0-9][0-9][0-9][0-9].m4a"))
+	if err != nil {
+		return err
+	}
+	for _, p := range partials {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+	"github.com/qitoi/space-dl/sidecar"
+)
+
+const (
+	ParticipantsFilename = sidecar.ParticipantsFilename
+)
+
+type participantTracker struct {
+	file         string
+	total        int
+	updatedAt    time.Time
+	participants map[string]*sidecar.Participant
+	order        []string
+}
+
+func newParticipantTracker(file string) *participantTracker {
+	return &participantTracker{
+		file:         file,
+		participants: make(map[string]*sidecar.Participant),
+	}
+}
+
+func (t *participantTracker) update(resp *spacedl.AudioSpaceByIDResponse, now time.Time) {
+	p := resp.Data.AudioSpace.Participants
+	t.total = p.Total
+	t.updatedAt = now
+
+	for _, u := range p.Admins {
+		t.add(u, sidecar.RoleAdmin, now)
+	}
+	for _, u := range p.Speakers {
+		t.add(u, sidecar.RoleSpeaker, now)
+	}
+	for _, u := range p.Listeners {
+		t.add(u, sidecar.RoleListener, now)
+	}
+}
+
+func (t *participantTracker) add(u spacedl.User, role string, now time.Time) {
+	id := u.UserResults.RestId
+	if id == "" {
+		id = u.PeriscopeUserId
+	}
+	if id == "" {
+		return
+	}
+
+	p, ok := t.participants[id]
+	if !ok {
+		p = &sidecar.Participant{
+			UserID:          u.UserResults.RestId,
+			PeriscopeUserID: u.PeriscopeUserId,
+			FirstSeen:       now,
+		}
+		if u.Start > 0 {
+			joinedAt := time.Unix(u.Start/1000, u.Start%1000*int64(time.Millisecond))
+			p.JoinedAt = &joinedAt
+		}
+		t.participants[id] = p
+		t.order = append(t.order, id)
+	}
+
+	p.ScreenName = u.TwitterScreenName
+	p.DisplayName = u.DisplayName
+	p.LastSeen = now
+
+	if !hasRole(p.Roles, role) {
+		p.Roles = append(p.Roles, role)
+	}
+	if role != sidecar.RoleListener && p.FirstSpoke == nil {
+		spoke := now
+		p.FirstSpoke = &spoke
+	}
+}
+
+func (t *participantTracker) save() error {
+	snapshot := &sidecar.Participants{
+		UpdatedAt: t.updatedAt,
+		Total:     t.total,
+	}
+	for _, id := range t.order {
+		snapshot.Participants = append(snapshot.Participants, t.participants[id])
+	}
+
+	return sidecar.WriteParticipants(t.file, snapshot)
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	ioClassNone = iota
+	ioClassRealtime
+	ioClassBestEffort
+	ioClassIdle
+)
+
+type processPriority struct {
+	nice    int
+	ioClass int
+	ioLevel int
+}
+
+func (p *processPriority) parseIOClass(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	name, level, hasLevel := strings.Cut(s, ":")
+	switch name {
+	case "realtime":
+		p.ioClass = ioClassRealtime
+	case "best-effort":
+		p.ioClass = ioClassBestEffort
+	case "idle":
+		p.ioClass = ioClassIdle
+		if hasLevel {
+			return fmt.Errorf("invalid ionice: %s: idle class has no level", s)
+		}
+	default:
+		return fmt.Errorf("invalid ionice: %s", s)
+	}
+
+	p.ioLevel = 4
+	if hasLevel {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return fmt.Errorf("invalid ionice: %s: level must be 0-7", s)
+		}
+		p.ioLevel = n
+	}
+
+	return nil
+}
+
+func (p processPriority) isSet() bool {
+	return p.nice != 0 || p.ioClass != ioClassNone
+}
+
+func setProcessPriority(pid int, p processPriority) error {
+	if p.nice != 0 {
+		if err := setNice(pid, p.nice); err != nil {
+			return err
+		}
+	}
+
+	if p.ioClass != ioClassNone {
+		if err := setIOPriority(pid, p.ioClass, p.ioLevel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startProcess starts the command with the priority, the command keeps the normal priority if it cannot be set
+func startProcess(cmd *exec.Cmd, priority processPriority, logger *log.Logger) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if priority.isSet() {
+		if err := setProcessPriority(cmd.Process.Pid, priority); err != nil && logger != nil {
+			logger.Printf("set process priority error: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+func runProcess(cmd *exec.Cmd, priority processPriority, logger *log.Logger) error {
+	if err := startProcess(cmd, priority, logger); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,263 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+	"github.com/qitoi/space-dl/sidecar"
+)
+
+type recordingFile struct {
+	audio    string
+	metadata string
+	track    int
+	total    int
+}
+
+func refreshCommand(args []string) int {
+	var clientOpts clientOptions
+	var ffmpegPath string
+	var timezone string
+	flags := pflag.NewFlagSet("refresh", pflag.ExitOnError)
+	flags.StringVar(&ffmpegPath, "ffmpeg-path", "", "path to ffmpeg executable (default: $"+spacedl.FFmpegPathEnv+" or ffmpeg in PATH)")
+	flags.StringVar(&timezone, "timezone", "", "timezone of directory names and date tags, e.g. UTC, Asia/Tokyo (default: local timezone)")
+	addClientFlags(flags, &clientOpts)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl refresh <dir|space_id>...")
+		return 1
+	}
+
+	loc, err := loadTimezone(timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ffmpeg := spacedl.NewFFmpeg(ffmpegPath)
+	if err := ffmpeg.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	client, err := newClient(&clientOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, arg := range flags.Args() {
+		dir, err := refreshRecording(client, ffmpeg, loc, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: metadata updated\n", dir)
+	}
+
+	return code
+}
+
+func refreshRecording(client *spacedl.Client, ffmpeg *spacedl.FFmpeg, loc *time.Location, arg string) (string, error) {
+	var dir, spaceID string
+	if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+		dir = filepath.Clean(arg)
+		if spaceID, err = readSpaceID(dir); err != nil {
+			return "", err
+		}
+	} else {
+		if spaceID, err = spacedl.ParseSpaceID(arg); err != nil {
+			return "", err
+		}
+	}
+
+	resp, _, err := getAudioSpaceInfo(client, buildAudioSpaceInfoParams(spaceID))
+	if err != nil {
+		return "", err
+	}
+
+	startedAtUnix := resp.Data.AudioSpace.Metadata.StartedAt
+	startedAt := time.Unix(startedAtUnix/1000, startedAtUnix%1000*1000000).In(loc)
+	u := spacedl.GetOwnerUser(resp)
+
+	if dir == "" {
+		if u == nil {
+			return "", errors.New("user not found")
+		}
+		dir = recordingDirName(startedAt, u.TwitterScreenName)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return "", fmt.Errorf("recording directory not found: %s", dir)
+		}
+	}
+
+	// stats
+	statsFile := filepath.Join(dir, StatsFilename)
+	stats, err := loadStats(statsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		stats = &sidecar.Stats{SpaceID: spaceID}
+	} else if err != nil {
+		return "", err
+	}
+	updateStats(stats, resp, time.Now())
+	if err := saveStats(statsFile, stats); err != nil {
+		return "", err
+	}
+
+	// participants are only available while the space is live, keep the recorded ones
+	participantsFile := filepath.Join(dir, ParticipantsFilename)
+	if _, err := os.Stat(participantsFile); errors.Is(err, os.ErrNotExist) {
+		tracker := newParticipantTracker(participantsFile)
+		tracker.update(resp, time.Now())
+		if err := tracker.save(); err != nil {
+			return "", err
+		}
+	}
+
+	// metadata and tags
+	name := ""
+	if u != nil {
+		name = u.DisplayName
+	}
+	latest := buildMetadata(spaceID, resp.Data.AudioSpace.Metadata.Title, name, startedAt)
+
+	files, err := findRecordingFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if err := refreshMetadata(file, latest); err != nil {
+			return "", err
+		}
+		if file.audio == "" {
+			continue
+		}
+		if err := retagAudio(ffmpeg, file); err != nil {
+			return "", fmt.Errorf("%s: %v", file.audio, err)
+		}
+	}
+
+	return dir, nil
+}
+
+func findRecordingFiles(dir string) ([]*recordingFile, error) {
+	files := []*recordingFile{{
+		metadata: filepath.Join(dir, MetadataFilename),
+	}}
+	for _, output := range []string{dir + ".m4a", dir + ".preview.m4a"} {
+		if _, err := os.Stat(output); err == nil {
+			files[0].audio = output
+			break
+		}
+	}
+
+	// split parts
+	parts, err := filepath.Glob(dir + "-[0-9][0-9][0-9].m4a")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(parts)
+	for i, part := range parts {
+		files = append(files, &recordingFile{
+			audio:    part,
+			metadata: filepath.Join(dir, fmt.Sprintf("metadata-%03d.txt", i+1)),
+			track:    i + 1,
+			total:    len(parts),
+		})
+	}
+
+	return files, nil
+}
+
+func refreshMetadata(file *recordingFile, latest *spacedl.Metadata) error {
+	f, err := os.Open(file.metadata)
+	if err != nil {
+		return err
+	}
+	meta, err := spacedl.ParseMetadata(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"title", "artist", "date", "comment"} {
+		v, ok := latest.Get(key)
+		if !ok || v == "" {
+			continue
+		}
+		if key == "title" && file.total > 0 {
+			v = fmt.Sprintf("%s (%d/%d)", v, file.track, file.total)
+		}
+		meta.Set(key, v)
+	}
+
+	return saveMetadata(file.metadata, meta)
+}
+
+func retagAudio(ffmpeg *spacedl.FFmpeg, file *recordingFile) error {
+	ext := filepath.Ext(file.audio)
+	tmp := strings.TrimSuffix(file.audio, ext) + ".refresh" + ext
+
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", file.audio,
+		"-i", file.metadata,
+		"-map", "0",
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+		"-codec", "copy",
+	}
+	if hasReplayGain(file.metadata) {
+		args = append(args, "-movflags", "use_metadata_tags")
+	}
+	args = append(args, "-y", tmp)
+
+	if out, err := ffmpeg.Command(args...).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return os.Rename(tmp, file.audio)
+}
+
+func hasReplayGain(metadata string) bool {
+	f, err := os.Open(metadata)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	meta, err := spacedl.ParseMetadata(f)
+	if err != nil {
+		return false
+	}
+	_, ok := meta.Get("REPLAYGAIN_TRACK_GAIN")
+	return ok
+}
@@ -0,0 +1,88 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+// withRetry calls fn until it succeeds, fails with a permanent error, retries are exhausted or ctx is done
+func withRetry(ctx context.Context, opts *options, printf func(format string, v ...interface{}), fn func() error) error {
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || retry >= opts.retries || !isTransientError(err) {
+			return err
+		}
+		delay := opts.retryDelay
+		var rle *spacedl.RateLimitError
+		if errors.As(err, &rle) && rle.RetryAfter() > delay {
+			delay = rle.RetryAfter()
+		}
+		printf("%v, retrying in %v (%d/%d)\n", err, delay, retry+1, opts.retries)
+		timer := clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errShutdown
+		case <-timer.C():
+		}
+	}
+}
+
+func isTransientError(err error) bool {
+	var rle *spacedl.RateLimitError
+	if errors.As(err, &rle) {
+		return true
+	}
+
+	var qe *spacedl.QueryError
+	if errors.As(err, &qe) {
+		if qe.StatusCode >= 500 || qe.StatusCode == 429 {
+			return true
+		}
+		if qe.Classification() == spacedl.ClassificationOverCapacity {
+			return true
+		}
+		for _, e := range qe.Errors {
+			if strings.Contains(strings.ToLower(e.Message), "guest token") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ue *url.Error
+	var ne net.Error
+	if errors.As(err, &ue) || errors.As(err, &ne) {
+		return true
+	}
+
+	// guest token activation failures
+	return strings.Contains(err.Error(), "guest token")
+}
+
+func printStderr(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, v...)
+}
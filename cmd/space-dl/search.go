@@ -0,0 +1,89 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+func searchCommand(args []string) int {
+	var clientOpts clientOptions
+	var filter string
+	var idsOnly bool
+	flags := pflag.NewFlagSet("search", pflag.ExitOnError)
+	flags.StringVar(&filter, "filter", spacedl.SearchFilterTop, "search filter (top, live, upcoming)")
+	flags.BoolVar(&idsOnly, "ids", false, "print only space ids, for --batch-file")
+	addClientFlags(flags, &clientOpts)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl search [--filter top|live|upcoming] [--ids] <query>...")
+		return 1
+	}
+	switch filter {
+	case spacedl.SearchFilterTop, spacedl.SearchFilterLive, spacedl.SearchFilterUpcoming:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid filter: %s\n", filter)
+		return 1
+	}
+
+	client, err := newClient(&clientOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	spaces, err := client.SearchSpaces(strings.Join(flags.Args(), " "), filter)
+	if err != nil {
+		printError("", err)
+		return 1
+	}
+
+	if idsOnly {
+		for _, s := range spaces {
+			fmt.Println(s.SpaceID)
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SPACE\tSTATE\tLISTENERS\tSTART\tTITLE")
+	for _, s := range spaces {
+		start := s.StartedAt
+		if start.IsZero() {
+			start = s.ScheduledStart
+		}
+		startStr := "-"
+		if !start.IsZero() {
+			startStr = start.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.SpaceID, s.State, s.Listeners, startStr, s.Title)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,123 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	SessionFilename = "session.yaml"
+
+	sessionSpaceIDKey = "space_id"
+)
+
+// sessionExcludedFlags are not saved to session files, which are kept next to the recordings
+var sessionExcludedFlags = map[string]bool{
+	"auth-token": true,
+	"ct0":        true,
+	"header":     true,
+}
+
+func saveSession(file, spaceID string, flags *pflag.FlagSet) error {
+	var b strings.Builder
+	b.WriteString("# space-dl session, repeat the recording with: space-dl rerun " + SessionFilename + "\n")
+	fmt.Fprintf(&b, "# created at %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "%s: %s\n", sessionSpaceIDKey, spaceID)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if configExcludedFlags[flag.Name] || sessionExcludedFlags[flag.Name] {
+			return
+		}
+		fmt.Fprintf(&b, "%s: %s\n", flag.Name, formatConfigValue(flag.Value.String()))
+	})
+
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
+
+func rerunCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl rerun <session.yaml>")
+		return 1
+	}
+
+	rerunArgs, err := sessionArgs(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	cmd := exec.Command(exe, rerunArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fmt.Printf("rerun: %s\n", cmd.String())
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func sessionArgs(file string) ([]string, error) {
+	entries, err := readConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	spaceID := ""
+	var args []string
+	for _, e := range entries {
+		if e.key == sessionSpaceIDKey {
+			spaceID = e.value
+			continue
+		}
+		// the archive would skip the space recorded by the session
+		if e.key == "download-archive" {
+			continue
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", e.key, e.value))
+	}
+	if spaceID == "" {
+		return nil, fmt.Errorf("%s: %s not found", file, sessionSpaceIDKey)
+	}
+
+	// options given in the session must not be overridden by the config file
+	args = append(args, "--config="+os.DevNull, spaceID)
+
+	return args, nil
+}
@@ -0,0 +1,207 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	silenceCheckInterval = 1 * time.Minute
+)
+
+var (
+	meanVolumeRegexp = regexp.MustCompile(`mean_volume: (-?[0-9.]+|-inf) dB`)
+)
+
+type silenceMonitor struct {
+	ffmpeg    *spacedl.FFmpeg
+	priority  processPriority
+	dir       string
+	threshold float64
+	alert     time.Duration
+	command   string
+	spaceID   string
+	logger    *log.Logger
+
+	lastCheck   time.Time
+	silentSince time.Time
+	alerted     bool
+}
+
+func newSilenceMonitor(spaceID, dir string, opts *options, logger *log.Logger) *silenceMonitor {
+	return &silenceMonitor{
+		ffmpeg:    opts.ffmpeg,
+		priority:  opts.priority,
+		dir:       dir,
+		threshold: opts.silenceThreshold,
+		alert:     opts.silenceAlert,
+		command:   opts.silenceCommand,
+		spaceID:   spaceID,
+		logger:    logger,
+		lastCheck: clock.Now(),
+	}
+}
+
+func (m *silenceMonitor) start(interval time.Duration) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C():
+				m.check(now)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (m *silenceMonitor) check(now time.Time) {
+	files, err := m.recentSegments(m.lastCheck)
+	if err != nil {
+		m.logger.Printf("silence check error: %v\n", err)
+		return
+	}
+	m.lastCheck = now
+
+	// no new segments is treated as silence
+	volume := math.Inf(-1)
+	if len(files) > 0 {
+		volume, err = m.meanVolume(files)
+		if err != nil {
+			m.logger.Printf("silence check error: %v\n", err)
+			return
+		}
+	}
+
+	if volume >= m.threshold {
+		if m.alerted {
+			m.logger.Printf("audio resumed (mean volume: %.1f dB)\n", volume)
+		}
+		m.silentSince = time.Time{}
+		m.alerted = false
+		return
+	}
+
+	if m.silentSince.IsZero() {
+		m.silentSince = now
+	}
+
+	silent := now.Sub(m.silentSince)
+	if !m.alerted && silent >= m.alert {
+		m.alerted = true
+		m.logger.Printf("WARNING: no audio for %v (mean volume: %.1f dB)\n", silent.Round(time.Second), volume)
+		if m.command != "" {
+			m.notify(silent)
+		}
+	}
+}
+
+func (m *silenceMonitor) recentSegments(since time.Time) ([]string, error) {
+	fis, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, fi := range fis {
+		if filepath.Ext(fi.Name()) != ".aac" || !fi.ModTime().After(since) {
+			continue
+		}
+		files = append(files, filepath.Join(m.dir, fi.Name()))
+	}
+
+	return files, nil
+}
+
+func (m *silenceMonitor) meanVolume(files []string) (float64, error) {
+	cmd := m.ffmpeg.Command("-hide_banner", "-nostats", "-i", "pipe:0", "-af", "volumedetect", "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := startProcess(cmd, m.priority, m.logger); err != nil {
+		return 0, err
+	}
+
+	if err := writeFiles(stdin, files); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return 0, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return 0, err
+	}
+
+	matches := meanVolumeRegexp.FindStringSubmatch(stderr.String())
+	if matches == nil {
+		return 0, errors.New("mean volume not found")
+	}
+	if matches[1] == "-inf" {
+		return math.Inf(-1), nil
+	}
+
+	return strconv.ParseFloat(matches[1], 64)
+}
+
+func (m *silenceMonitor) notify(silent time.Duration) {
+	cmd := exec.Command(m.command)
+	cmd.Env = append(os.Environ(),
+		"SPACE_DL_SPACE_ID="+m.spaceID,
+		"SPACE_DL_DIR="+m.dir,
+		fmt.Sprintf("SPACE_DL_SILENCE_SECONDS=%d", int(silent.Seconds())),
+	)
+	cmd.Stdout = m.logger.Writer()
+	cmd.Stderr = cmd.Stdout
+
+	go func() {
+		if err := cmd.Run(); err != nil {
+			m.logger.Printf("silence command error: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+var (
+	durationRegexp = regexp.MustCompile(`Duration: ([0-9]+):([0-9]{2}):([0-9]{2}(?:\.[0-9]+)?)`)
+)
+
+func probeDuration(ffmpeg *spacedl.FFmpeg, priority processPriority, file string) (time.Duration, error) {
+	cmd := ffmpeg.Command("-hide_banner", "-i", file)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// ffmpeg exits with an error without an output file, ignore it
+	_ = runProcess(cmd, priority, nil)
+
+	m := durationRegexp.FindStringSubmatch(stderr.String())
+	if m == nil {
+		return 0, errors.New("duration not found")
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+
+	return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + seconds(sec), nil
+}
+
+func splitOutput(output string, meta *spacedl.Metadata, dir string, opts *options, logger *log.Logger) ([]string, error) {
+	total, err := probeDuration(opts.ffmpeg, opts.priority, output)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int((total + opts.split - 1) / opts.split)
+	if n <= 1 {
+		return []string{output}, nil
+	}
+
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+
+	var parts []string
+	for i := 0; i < n; i++ {
+		start := time.Duration(i) * opts.split
+		end := start + opts.split
+		if end > total {
+			end = total
+		}
+
+		partMeta := partMetadata(meta, i+1, n, start, end)
+		partMetaFile := filepath.Join(dir, fmt.Sprintf("metadata-%03d.txt", i+1))
+		if err := saveMetadata(partMetaFile, partMeta); err != nil {
+			return nil, err
+		}
+
+		part := fmt.Sprintf("%s-%03d%s", base, i+1, ext)
+		args := []string{
+			"-ss", fmt.Sprintf("%.3f", start.Seconds()),
+			"-t", fmt.Sprintf("%.3f", (end - start).Seconds()),
+			"-i", output,
+			"-i", partMetaFile,
+			"-map", "0",
+			"-map_metadata", "1",
+			"-map_chapters", "1",
+			"-codec", "copy",
+		}
+		if opts.replayGain && ext == ".m4a" {
+			args = append(args, "-movflags", "use_metadata_tags")
+		}
+		args = append(args, "-y", part)
+
+		cmd := opts.ffmpeg.Command(args...)
+		cmd.Stdout = logger.Writer()
+		cmd.Stderr = cmd.Stdout
+
+		logger.Printf("run: %s\n", cmd.String())
+
+		err := runProcess(cmd, opts.priority, logger)
+		os.Remove(partMetaFile)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	if err := os.Remove(output); err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func partMetadata(meta *spacedl.Metadata, track, total int, start, end time.Duration) *spacedl.Metadata {
+	m := meta.Clone()
+	m.Set("track", fmt.Sprintf("%d/%d", track, total))
+	if title, ok := m.Get("title"); ok {
+		m.Set("title", fmt.Sprintf("%s (%d/%d)", title, track, total))
+	}
+
+	m.ClearChapters()
+	for _, c := range meta.Chapters() {
+		if c.End <= start || c.Start >= end {
+			continue
+		}
+		if c.Start < start {
+			c.Start = start
+		}
+		if c.End > end {
+			c.End = end
+		}
+		c.Start -= start
+		c.End -= start
+		m.AddChapter(c)
+	}
+
+	return m
+}
@@ -0,0 +1,157 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	spacedl "github.com/qitoi/space-dl"
+	"github.com/qitoi/space-dl/sidecar"
+)
+
+const (
+	StatsFilename = sidecar.StatsFilename
+)
+
+// maxStatsSamples bounds the samples kept for a long running space.
+// once reached, every other sample is dropped so the whole timeline stays covered at a coarser interval.
+const (
+	maxStatsSamples = 2048
+)
+
+func updateStats(s *sidecar.Stats, resp *spacedl.AudioSpaceByIDResponse, now time.Time) {
+	metadata := resp.Data.AudioSpace.Metadata
+	s.State = metadata.State
+	s.UpdatedAt = now
+	s.TotalLiveListeners = metadata.TotalLiveListeners
+	s.TotalReplayWatched = metadata.TotalReplayWatched
+}
+
+func sampleStats(s *sidecar.Stats, resp *spacedl.AudioSpaceByIDResponse, now time.Time) {
+	updateStats(s, resp, now)
+	for len(s.Samples) >= maxStatsSamples {
+		s.Samples = downsampleStats(s.Samples)
+	}
+	s.Samples = append(s.Samples, sidecar.StatsSample{
+		Time:          now,
+		LiveListeners: resp.Data.AudioSpace.Metadata.TotalLiveListeners,
+		Participants:  resp.Data.AudioSpace.Participants.Total,
+	})
+}
+
+func downsampleStats(samples []sidecar.StatsSample) []sidecar.StatsSample {
+	n := 0
+	for i := 0; i < len(samples); i += 2 {
+		samples[n] = samples[i]
+		n++
+	}
+	return samples[:n]
+}
+
+func loadStats(file string) (*sidecar.Stats, error) {
+	return sidecar.ReadStats(file)
+}
+
+func saveStats(file string, stats *sidecar.Stats) error {
+	return sidecar.WriteStats(file, stats)
+}
+
+func readSpaceID(dir string) (string, error) {
+	if stats, err := loadStats(filepath.Join(dir, StatsFilename)); err == nil && stats.SpaceID != "" {
+		return stats.SpaceID, nil
+	}
+
+	f, err := os.Open(filepath.Join(dir, MetadataFilename))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v := strings.TrimPrefix(scanner.Text(), "comment="); v != scanner.Text() {
+			return spacedl.ParseSpaceID(v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("space id not found in %s", dir)
+}
+
+func refreshStatsCommand(args []string) int {
+	var clientOpts clientOptions
+	flags := pflag.NewFlagSet("refresh-stats", pflag.ExitOnError)
+	addClientFlags(flags, &clientOpts)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: space-dl refresh-stats <dir>...")
+		return 1
+	}
+
+	client, err := newClient(&clientOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, dir := range flags.Args() {
+		if err := refreshStats(client, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: stats updated\n", dir)
+	}
+
+	return code
+}
+
+func refreshStats(client *spacedl.Client, dir string) error {
+	spaceID, err := readSpaceID(dir)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, StatsFilename)
+	stats, err := loadStats(file)
+	if errors.Is(err, os.ErrNotExist) {
+		stats = &sidecar.Stats{SpaceID: spaceID}
+	} else if err != nil {
+		return err
+	}
+
+	resp, _, err := getAudioSpaceInfo(client, buildAudioSpaceInfoParams(spaceID))
+	if err != nil {
+		return err
+	}
+
+	updateStats(stats, resp, time.Now())
+
+	return saveStats(file, stats)
+}
@@ -0,0 +1,136 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+var (
+	summaryMu sync.Mutex
+)
+
+type summaryHost struct {
+	ScreenName string `json:"screen_name"`
+	Name       string `json:"name"`
+}
+
+type summaryOutput struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type recordingSummary struct {
+	SpaceID          string          `json:"space_id"`
+	Title            string          `json:"title"`
+	Host             summaryHost     `json:"host"`
+	Duration         float64         `json:"duration"`
+	SegmentCount     int             `json:"segment_count"`
+	MissingSequences []uint64        `json:"missing_sequences"`
+	Outputs          []summaryOutput `json:"outputs"`
+}
+
+func buildSummary(spaceID, title string, host *spacedl.User, segments []string, missing []uint64, outputs []string, opts *options) (*recordingSummary, error) {
+	summary := &recordingSummary{
+		SpaceID: spaceID,
+		Title:   title,
+		Host: summaryHost{
+			ScreenName: host.TwitterScreenName,
+			Name:       host.DisplayName,
+		},
+		SegmentCount:     len(segments),
+		MissingSequences: missing,
+	}
+	if summary.MissingSequences == nil {
+		summary.MissingSequences = []uint64{}
+	}
+
+	for _, output := range outputs {
+		duration, err := probeDuration(opts.ffmpeg, opts.priority, output)
+		if err != nil {
+			return nil, err
+		}
+		summary.Duration += duration.Seconds()
+
+		p, err := filepath.Abs(output)
+		if err != nil {
+			return nil, err
+		}
+		size, sum, err := hashFile(output)
+		if err != nil {
+			return nil, err
+		}
+		summary.Outputs = append(summary.Outputs, summaryOutput{
+			Path:   p,
+			Size:   size,
+			SHA256: sum,
+		})
+	}
+
+	return summary, nil
+}
+
+func hashFile(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeSummary(file string, summary *recordingSummary) error {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	// concurrent batch jobs share the file
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+
+	if file == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(b)
+	return err
+}
@@ -0,0 +1,49 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+// traceHooks logs the timing of each request, empty hooks are returned if tracing is disabled
+func traceHooks(enabled bool, logger *log.Logger) spacedl.Hooks {
+	if !enabled {
+		return spacedl.Hooks{}
+	}
+	return spacedl.Hooks{
+		Trace: true,
+		RequestFinished: func(info spacedl.RequestInfo) {
+			status := strconv.Itoa(info.StatusCode)
+			if info.Err != nil {
+				status = "error: " + info.Err.Error()
+			}
+			t := info.Timing
+			logger.Printf("trace: %s %s%s %s dns=%v connect=%v tls=%v ttfb=%v total=%v reused=%v bytes=%d\n",
+				info.Method, info.URL.Host, info.URL.Path, status,
+				ms(t.DNS), ms(t.Connect), ms(t.TLS), ms(t.TTFB), ms(info.Duration), t.ConnReused, info.Bytes)
+		},
+	}
+}
+
+func ms(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,205 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+var (
+	screenNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+)
+
+func readWatchFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimPrefix(strings.TrimSpace(line), "@")
+		if line == "" {
+			continue
+		}
+
+		if !screenNameRegexp.MatchString(line) {
+			return nil, fmt.Errorf("%s:%d: invalid screen name: %s", file, n, line)
+		}
+		// screen names are case insensitive
+		if key := strings.ToLower(line); !seen[key] {
+			seen[key] = true
+			names = append(names, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+type watcher struct {
+	file string
+	opts *options
+
+	client  *spacedl.Client
+	userIDs map[string]string
+	unknown map[string]bool
+	seen    map[string]bool
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	recorded int
+	errs     []error
+}
+
+// runWatch polls the users in the watch file and records their spaces when they go live,
+// the file is read on every poll so users can be added or removed while running.
+func runWatch(file string, interval time.Duration, opts *options) int {
+	w := &watcher{
+		file:    file,
+		opts:    opts,
+		userIDs: make(map[string]string),
+		unknown: make(map[string]bool),
+		seen:    make(map[string]bool),
+	}
+
+	ctx, cancel := shutdownContext()
+	defer cancel()
+
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			printError("watch: ", err)
+		}
+
+		timer := clock.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C():
+			continue
+		}
+		break
+	}
+
+	w.wg.Wait()
+
+	code := 0
+	for _, err := range w.errs {
+		if c := exitCode(err); code == 0 || c == 1 {
+			code = c
+		}
+	}
+
+	fmt.Printf("watch: %d succeeded, %d failed\n", w.recorded-len(w.errs), len(w.errs))
+
+	return code
+}
+
+func (w *watcher) poll(ctx context.Context) error {
+	names, err := readWatchFile(w.file)
+	if err != nil {
+		return err
+	}
+
+	if w.client == nil {
+		if w.client, err = newClient(&w.opts.client); err != nil {
+			return err
+		}
+	}
+
+	var userIDs []string
+	screenNames := make(map[string]string)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if w.unknown[key] {
+			continue
+		}
+		id, ok := w.userIDs[key]
+		if !ok {
+			id, err = w.client.GetUserIDContext(ctx, name)
+			if errors.Is(err, spacedl.ErrNotFound) {
+				fmt.Fprintf(os.Stderr, "watch: user not found: %s\n", name)
+				w.unknown[key] = true
+				continue
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			w.userIDs[key] = id
+		}
+		userIDs = append(userIDs, id)
+		screenNames[id] = name
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// GetUserSpaces looks up the users in batches
+	spaces, err := w.client.GetUserSpacesContext(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range spaces {
+		if !s.IsLive() || w.seen[s.SpaceID] || ctx.Err() != nil {
+			continue
+		}
+		w.seen[s.SpaceID] = true
+		w.record(screenNames[s.UserID], s.SpaceID)
+	}
+
+	return nil
+}
+
+func (w *watcher) record(name, spaceID string) {
+	fmt.Printf("watch: @%s is live, recording %s\n", name, spaceID)
+
+	w.mu.Lock()
+	w.recorded += 1
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		if err := run(spaceID, w.opts); err != nil {
+			printError(spaceID+": ", err)
+			w.mu.Lock()
+			w.errs = append(w.errs, err)
+			w.mu.Unlock()
+		}
+	}()
+}
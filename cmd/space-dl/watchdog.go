@@ -0,0 +1,90 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+type outputWatchdog struct {
+	file    string
+	timeout time.Duration
+	kill    func()
+
+	mu      sync.Mutex
+	stalled bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// startOutputWatchdog calls kill when the file does not grow for the timeout
+func startOutputWatchdog(file string, timeout time.Duration, kill func()) *outputWatchdog {
+	w := &outputWatchdog{
+		file:    file,
+		timeout: timeout,
+		kill:    kill,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *outputWatchdog) run() {
+	defer close(w.done)
+
+	interval := w.timeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	var size int64 = -1
+	lastGrowth := clock.Now()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C():
+			if fi, err := os.Stat(w.file); err == nil && fi.Size() != size {
+				size = fi.Size()
+				lastGrowth = now
+				continue
+			}
+			if now.Sub(lastGrowth) >= w.timeout {
+				w.mu.Lock()
+				w.stalled = true
+				w.mu.Unlock()
+				w.kill()
+				return
+			}
+		}
+	}
+}
+
+// Stop stops watching and reports whether the watchdog killed the process
+func (w *outputWatchdog) Stop() bool {
+	close(w.stop)
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stalled
+}
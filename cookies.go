@@ -0,0 +1,151 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	httpOnlyPrefix = "#HttpOnly_"
+)
+
+var (
+	twitterURL = &url.URL{Scheme: "https", Host: "twitter.com", Path: "/"}
+)
+
+// ReadCookiesTxt reads cookies of twitter.com and x.com from a Netscape format cookies.txt.
+// Expired cookies are skipped.
+func ReadCookiesTxt(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	now := time.Now()
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookies.txt line %d: invalid format", n)
+		}
+
+		domain := fields[0]
+		if !isCookieDomain(domain) {
+			continue
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies.txt line %d: invalid expiry: %w", n, err)
+		}
+		cookie := &http.Cookie{
+			Domain:   strings.TrimPrefix(domain, "."),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		// 0 is a session cookie
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, errors.New("no twitter.com or x.com cookies found")
+	}
+
+	return cookies, nil
+}
+
+func isCookieDomain(domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	for _, d := range []string{"twitter.com", "x.com"} {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCookies adds the cookies to the Client's cookie jar, x.com cookies are sent to twitter.com.
+// If auth_token and ct0 are included, they are used as the logged in session unless WithSession is given.
+func WithCookies(cookies []*http.Cookie) ClientOption {
+	return func(c *Client) {
+		c.cookies = append(c.cookies, cookies...)
+	}
+}
+
+func (c *Client) applyCookies() {
+	var authToken, ct0 string
+	var others []*http.Cookie
+	for _, cookie := range c.cookies {
+		switch cookie.Name {
+		case "auth_token":
+			authToken = cookie.Value
+		case "ct0":
+			ct0 = cookie.Value
+		default:
+			others = append(others, cookie)
+		}
+	}
+
+	if c.authToken == "" && authToken != "" && ct0 != "" {
+		c.authToken = authToken
+		c.csrfToken = ct0
+	}
+	if c.client.Jar != nil {
+		c.client.Jar.SetCookies(twitterURL, cookiesForDomain(others, twitterURL.Host))
+		// the site of the endpoints may be another host, e.g. x.com
+		if u, err := url.Parse(c.endpoints.Index); err == nil && u.Host != "" && u.Hostname() != twitterURL.Host {
+			c.client.Jar.SetCookies(u, cookiesForDomain(others, u.Hostname()))
+		}
+	}
+}
+
+func cookiesForDomain(cookies []*http.Cookie, domain string) []*http.Cookie {
+	copied := make([]*http.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		cc := *cookie
+		cc.Domain = domain
+		copied = append(copied, &cc)
+	}
+	return copied
+}
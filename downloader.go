@@ -17,8 +17,10 @@
 package spacedl
 
 import (
+	"context"
 	"errors"
-	"io"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
@@ -34,47 +36,110 @@ const (
 	playlistDownloadErrorLimit = 30
 )
 
+// ErrHalted is returned by Download when the download was stopped by Halt before all segments were downloaded
+var ErrHalted = errors.New("download halted")
+
+type SegmentFilter func(seq uint64, data []byte) ([]byte, bool)
+
+// Limiter bounds the number of concurrent segment downloads shared by multiple downloaders
+type Limiter struct {
+	ch chan struct{}
+}
+
+func NewLimiter(n int) *Limiter {
+	return &Limiter{
+		ch: make(chan struct{}, n),
+	}
+}
+
+func (l *Limiter) acquire() {
+	l.ch <- struct{}{}
+}
+
+func (l *Limiter) release() {
+	<-l.ch
+}
+
+type segment struct {
+	seq uint64
+	url *url.URL
+}
+
 type Downloader struct {
-	url    string
-	output string
-	seq    sync.Map
+	url        string
+	output     string
+	seq        sync.Map
+	downloaded sync.Map
+	duration   time.Duration
 
-	halt chan struct{}
-	dlCh chan *url.URL
-	wg   sync.WaitGroup
+	halt     chan struct{}
+	haltOnce sync.Once
+	haltMu   sync.Mutex
+	dlCh     chan *segment
+	wg       sync.WaitGroup
+	filters  []SegmentFilter
 
-	Parallel int
-	Done     chan struct{}
-	Logger   *log.Logger
+	Parallel    int
+	MaxDuration time.Duration
+	// BackfillLimiter is shared by replay downloads, live downloads by Start are not limited
+	BackfillLimiter *Limiter
+	UserAgent       string
+	// HTTPClient is used for playlist and segment requests, a client with the transport shared in the package if nil
+	HTTPClient *http.Client
+	// Hooks are called for playlist and segment requests
+	Hooks Hooks
+	// OnEvent is called with the progress of the download, it may be called concurrently by the download goroutines
+	OnEvent func(ev DownloadEvent)
+	Done    chan struct{}
+	Logger  *log.Logger
+	Clock   Clock
 }
 
 func NewDownloader(url string, outputDir string) *Downloader {
 	return &Downloader{
-		url:      url,
-		output:   outputDir,
-		Parallel: 3,
+		url:       url,
+		output:    outputDir,
+		halt:      make(chan struct{}),
+		Parallel:  3,
+		UserAgent: DefaultUserAgent,
+		Clock:     SystemClock,
 	}
 }
 
 func (d *Downloader) Start(interval time.Duration) {
+	d.StartContext(context.Background(), interval)
+}
+
+// StartContext is Start stopped by ctx as well as Halt.
+// When ctx is done, the playlist is not polled anymore, the segments being downloaded are aborted and Done is closed.
+func (d *Downloader) StartContext(ctx context.Context, interval time.Duration) {
 	d.seq = sync.Map{}
+	d.downloaded = sync.Map{}
+	d.duration = 0
 	d.Done = make(chan struct{})
-	d.halt = make(chan struct{})
-	d.dlCh = make(chan *url.URL, 10)
+	d.dlCh = make(chan *segment, 10)
+	halt := d.resetHalt()
+
+	stop := afterFunc(ctx, d.Halt)
 
 	// queue segment
 	go func() {
 		defer close(d.dlCh)
 		errCount := 0
-		ticker := time.NewTicker(interval)
+		ticker := d.Clock.NewTicker(interval)
+		defer ticker.Stop()
 	loop:
 		for {
 			select {
-			case <-d.halt:
+			case <-halt:
 				break loop
-			case <-ticker.C:
-				if urls, err := d.getSegments(); err != nil {
+			case <-ticker.C():
+				if segments, err := d.getSegments(ctx); err != nil {
+					if ctx.Err() != nil {
+						break loop
+					}
 					d.print("playlist download error: %v", err)
+					d.emit(DownloadEvent{Type: DownloadEventPlaylistError, URL: d.url, Err: err})
 					errCount += 1
 					if errCount > playlistDownloadErrorLimit {
 						d.print("exceed error limit")
@@ -83,8 +148,14 @@ func (d *Downloader) Start(interval time.Duration) {
 					}
 				} else {
 					errCount = 0
-					for _, u := range urls {
-						d.dlCh <- u
+					for _, seg := range segments {
+						d.dlCh <- seg
+						d.emitQueued(seg)
+					}
+					if d.reachedMaxDuration() {
+						d.print("reached max duration")
+						d.Halt()
+						break loop
 					}
 				}
 			}
@@ -96,9 +167,13 @@ func (d *Downloader) Start(interval time.Duration) {
 	for i := 0; i < d.Parallel; i++ {
 		go func() {
 			defer d.wg.Done()
-			for u := range d.dlCh {
-				if err := d.downloadSegment(u); err != nil {
-					d.print("download error (%v): %v", *u, err)
+			for seg := range d.dlCh {
+				// the queued segments are drained without downloading after ctx is done
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := d.downloadSegment(ctx, seg); err != nil && ctx.Err() == nil {
+					d.print("download error (%v): %v", *seg.url, err)
 				}
 			}
 		}()
@@ -106,96 +181,322 @@ func (d *Downloader) Start(interval time.Duration) {
 
 	go func() {
 		d.wg.Wait()
+		stop()
 		close(d.Done)
 	}()
 }
 
+func (d *Downloader) AddFilter(f SegmentFilter) {
+	d.filters = append(d.filters, f)
+}
+
+// Halt stops the running download. A halted Downloader can be started again by Start or Download.
 func (d *Downloader) Halt() {
-	d.print("halt download")
-	close(d.halt)
+	d.haltMu.Lock()
+	defer d.haltMu.Unlock()
+
+	d.haltOnce.Do(func() {
+		d.print("halt download")
+		close(d.halt)
+	})
+}
+
+// resetHalt makes a new halt channel for the run, Halt called by the previous run does not stop it
+func (d *Downloader) resetHalt() <-chan struct{} {
+	d.haltMu.Lock()
+	defer d.haltMu.Unlock()
+
+	d.halt = make(chan struct{})
+	d.haltOnce = sync.Once{}
+	return d.halt
+}
+
+func (d *Downloader) Download() error {
+	return d.DownloadContext(context.Background())
 }
 
-func (d *Downloader) getSegments() ([]*url.URL, error) {
-	req, err := http.NewRequest(http.MethodGet, d.url, nil)
+// DownloadContext is Download stopped by ctx as well as Halt.
+// The segments being downloaded are aborted by ctx, and finished by Halt.
+// It returns ctx.Err() if stopped by ctx, or ErrHalted if stopped by Halt.
+func (d *Downloader) DownloadContext(ctx context.Context) error {
+	d.seq = sync.Map{}
+	d.downloaded = sync.Map{}
+	d.duration = 0
+
+	halt := d.resetHalt()
+
+	segments, err := d.getSegments(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	stop := afterFunc(ctx, d.Halt)
+	defer stop()
+
+	ch := make(chan *segment)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	aborted := false
+
+	wg.Add(d.Parallel)
+	for i := 0; i < d.Parallel; i++ {
+		go func() {
+			defer wg.Done()
+			for seg := range ch {
+				if d.BackfillLimiter != nil {
+					d.BackfillLimiter.acquire()
+				}
+				err := d.downloadSegment(ctx, seg)
+				if d.BackfillLimiter != nil {
+					d.BackfillLimiter.release()
+				}
+				if err != nil {
+					mu.Lock()
+					if ctx.Err() != nil {
+						aborted = true
+					} else {
+						d.print("download error (%v): %v", *seg.url, err)
+						failed += 1
+					}
+					mu.Unlock()
+				}
+			}
+		}()
 	}
-	defer resp.Body.Close()
 
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
-	if err != nil {
-		return nil, err
+	interrupted := false
+loop:
+	for _, seg := range segments {
+		select {
+		case <-halt:
+			interrupted = true
+			break loop
+		case ch <- seg:
+			d.emitQueued(seg)
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d segments failed to download", failed, len(segments))
 	}
+	if interrupted || aborted {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrHalted
+	}
+	return nil
+}
 
-	// check playlist type
-	if listType != m3u8.MEDIA {
-		return nil, errors.New("invalid playlist")
+// Missing returns sequence numbers which were skipped or failed to download
+func (d *Downloader) Missing() []uint64 {
+	first, last := uint64(0), uint64(0)
+	found := false
+	d.seq.Range(func(key, _ interface{}) bool {
+		seq := key.(uint64)
+		if !found || seq < first {
+			first = seq
+		}
+		if !found || seq > last {
+			last = seq
+		}
+		found = true
+		return true
+	})
+	if !found {
+		return nil
 	}
-	mediaPlaylist, ok := playlist.(*m3u8.MediaPlaylist)
-	if !ok {
-		return nil, errors.New("invalid playlist")
+
+	var missing []uint64
+	for seq := first; seq <= last; seq++ {
+		if _, ok := d.downloaded.Load(seq); !ok {
+			missing = append(missing, seq)
+		}
 	}
 
-	u, err := url.Parse(d.url)
+	return missing
+}
+
+func (d *Downloader) getSegments(ctx context.Context) ([]*segment, error) {
+	mediaPlaylist, u, err := d.getMediaPlaylist(ctx, d.url)
 	if err != nil {
 		return nil, err
 	}
 
-	var urls []*url.URL
+	var segments []*segment
 	for _, seg := range mediaPlaylist.Segments {
+		if d.reachedMaxDuration() {
+			break
+		}
 		if seg != nil {
 			if _, ok := d.seq.Load(seg.SeqId); !ok {
 				segURL, err := u.Parse(seg.URI)
 				if err != nil {
 					d.print("url parse error: %v", err)
+					continue
 				}
 
 				d.seq.Store(seg.SeqId, true)
-				urls = append(urls, segURL)
+				d.duration += time.Duration(seg.Duration * float64(time.Second))
+				segments = append(segments, &segment{
+					seq: seg.SeqId,
+					url: segURL,
+				})
 			}
 		}
 	}
 
-	return urls, nil
+	return segments, nil
 }
 
-func (d *Downloader) downloadSegment(u *url.URL) error {
-	d.print("download: %s", u.String())
+func (d *Downloader) reachedMaxDuration() bool {
+	return d.MaxDuration > 0 && d.duration >= d.MaxDuration
+}
 
-	if err := os.MkdirAll(d.output, 0777); err != nil {
-		return err
+func (d *Downloader) getMediaPlaylist(ctx context.Context, playlistURL string) (*m3u8.MediaPlaylist, *url.URL, error) {
+	u, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// output file
-	filename := filepath.Base(u.Path)
-	p := filepath.Join(d.output, filename)
-	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlistURL, nil)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	d.setHeader(req)
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	resp, err := sendWithHooks(d.httpClient(), d.Hooks, req, 1)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 
-	_, err = io.Copy(f, resp.Body)
+	switch listType {
+	case m3u8.MEDIA:
+		mediaPlaylist, ok := playlist.(*m3u8.MediaPlaylist)
+		if !ok {
+			return nil, nil, errors.New("invalid playlist")
+		}
+		return mediaPlaylist, u, nil
+	case m3u8.MASTER:
+		// replay playlists may point to variant playlists, use the best one
+		masterPlaylist, ok := playlist.(*m3u8.MasterPlaylist)
+		if !ok {
+			return nil, nil, errors.New("invalid playlist")
+		}
+		var best *m3u8.Variant
+		for _, v := range masterPlaylist.Variants {
+			if v != nil && (best == nil || v.Bandwidth > best.Bandwidth) {
+				best = v
+			}
+		}
+		if best == nil {
+			return nil, nil, errors.New("variant not found")
+		}
+		variantURL, err := u.Parse(best.URI)
+		if err != nil {
+			return nil, nil, err
+		}
+		return d.getMediaPlaylist(ctx, variantURL.String())
+	}
+
+	return nil, nil, errors.New("invalid playlist")
+}
+
+func (d *Downloader) downloadSegment(ctx context.Context, seg *segment) error {
+	start := d.Clock.Now()
+	n, dropped, err := d.fetchSegment(ctx, seg)
+
+	ev := DownloadEvent{
+		Type:    DownloadEventSegmentDownloaded,
+		Seq:     seg.seq,
+		URL:     seg.url.String(),
+		Bytes:   n,
+		Dropped: dropped,
+		Err:     err,
+	}
+	if err != nil {
+		ev.Type = DownloadEventSegmentFailed
+	}
+	ev.Time = d.Clock.Now()
+	ev.Duration = ev.Time.Sub(start)
+	d.emit(ev)
+
 	return err
 }
 
+// fetchSegment downloads the segment and writes it to the output directory, returns the size received
+func (d *Downloader) fetchSegment(ctx context.Context, seg *segment) (int, bool, error) {
+	u := seg.url
+	d.print("download: %s", u.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	d.setHeader(req)
+
+	resp, err := sendWithHooks(d.httpClient(), d.Hooks, req, 1)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return len(data), false, err
+	}
+	n := len(data)
+
+	for _, filter := range d.filters {
+		var ok bool
+		if data, ok = filter(seg.seq, data); !ok {
+			d.print("segment dropped by filter: %d", seg.seq)
+			d.downloaded.Store(seg.seq, true)
+			return n, true, nil
+		}
+	}
+
+	if err := os.MkdirAll(d.output, 0777); err != nil {
+		return n, false, err
+	}
+
+	// output file
+	filename := filepath.Base(u.Path)
+	p := filepath.Join(d.output, filename)
+	if err := ioutil.WriteFile(p, data, 0666); err != nil {
+		return n, false, err
+	}
+	d.downloaded.Store(seg.seq, true)
+
+	return n, false, nil
+}
+
+func (d *Downloader) httpClient() *http.Client {
+	if d.HTTPClient != nil {
+		return d.HTTPClient
+	}
+	return defaultHTTPClient()
+}
+
+func (d *Downloader) setHeader(req *http.Request) {
+	if d.UserAgent != "" {
+		req.Header.Set("User-Agent", d.UserAgent)
+	}
+}
+
 func (d *Downloader) print(format string, v ...interface{}) {
 	if d.Logger != nil {
 		d.Logger.Printf(format+"\n", v...)
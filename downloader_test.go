@@ -0,0 +1,126 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStream serves a replay playlist of n segments, segment requests are passed to handler
+func newTestStream(t *testing.T, n int, handler func(w http.ResponseWriter, r *http.Request, seq int)) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/playlist.m3u8" {
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&b, "#EXTINF:3.000,\nchunk_%d.aac\n", i)
+			}
+			b.WriteString("#EXT-X-ENDLIST\n")
+			w.Write([]byte(b.String()))
+			return
+		}
+		var seq int
+		if _, err := fmt.Sscanf(r.URL.Path, "/chunk_%d.aac", &seq); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r, seq)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL + "/playlist.m3u8"
+}
+
+func TestDownloadContextCanceled(t *testing.T) {
+	started := make(chan struct{}, 1)
+	playlist := newTestStream(t, 5, func(w http.ResponseWriter, r *http.Request, seq int) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		// the request is kept until it is aborted
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	d := NewDownloader(playlist, t.TempDir())
+	d.Parallel = 2
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.DownloadContext(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("segment requests were not aborted by the context")
+	}
+}
+
+func TestDownloadHalted(t *testing.T) {
+	const n = 5
+	playlist := newTestStream(t, n, func(w http.ResponseWriter, r *http.Request, seq int) {
+		fmt.Fprintf(w, "segment %d", seq)
+	})
+
+	d := NewDownloader(playlist, t.TempDir())
+	d.Parallel = 1
+	halt := true
+	d.AddFilter(func(seq uint64, data []byte) ([]byte, bool) {
+		if halt && seq == 0 {
+			d.Halt()
+			// let the queueing loop see the halt before the worker is ready for the next segment
+			time.Sleep(50 * time.Millisecond)
+		}
+		return data, true
+	})
+
+	if err := d.Download(); !errors.Is(err, ErrHalted) {
+		t.Fatalf("err = %v, want %v", err, ErrHalted)
+	}
+	if len(d.Missing()) == 0 {
+		t.Fatal("no segments are missing after halt")
+	}
+
+	// a halted downloader can be run again
+	halt = false
+	if err := d.Download(); err != nil {
+		t.Fatalf("download after halt: %v", err)
+	}
+	if missing := d.Missing(); len(missing) != 0 {
+		t.Errorf("missing segments: %v", missing)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"time"
+)
+
+type DownloadEventType int
+
+const (
+	DownloadEventUnknown DownloadEventType = iota
+	// DownloadEventSegmentQueued is emitted when a new segment found in the playlist is queued for download
+	DownloadEventSegmentQueued
+	DownloadEventSegmentDownloaded
+	DownloadEventSegmentFailed
+	DownloadEventPlaylistError
+)
+
+func (t DownloadEventType) String() string {
+	switch t {
+	case DownloadEventSegmentQueued:
+		return "segment_queued"
+	case DownloadEventSegmentDownloaded:
+		return "segment_downloaded"
+	case DownloadEventSegmentFailed:
+		return "segment_failed"
+	case DownloadEventPlaylistError:
+		return "playlist_error"
+	}
+	return "unknown"
+}
+
+// DownloadEvent is passed to Downloader.OnEvent to report the progress of the download.
+type DownloadEvent struct {
+	Type DownloadEventType
+	Time time.Time
+	// Seq is the sequence number of the segment, zero for playlist errors
+	Seq uint64
+	URL string
+	// Bytes is the size of the segment received
+	Bytes int
+	// Duration is the time taken to download the segment
+	Duration time.Duration
+	// Dropped is set if the segment was dropped by a filter
+	Dropped bool
+	// Err is set for DownloadEventSegmentFailed and DownloadEventPlaylistError
+	Err error
+}
+
+func (d *Downloader) emit(ev DownloadEvent) {
+	if d.OnEvent == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = d.Clock.Now()
+	}
+	d.OnEvent(ev)
+}
+
+func (d *Downloader) emitQueued(seg *segment) {
+	d.emit(DownloadEvent{Type: DownloadEventSegmentQueued, Seq: seg.seq, URL: seg.url.String()})
+}
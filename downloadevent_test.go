@@ -0,0 +1,144 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []DownloadEvent
+}
+
+func (r *eventRecorder) record(ev DownloadEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *eventRecorder) count() map[DownloadEventType]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[DownloadEventType]int)
+	for _, ev := range r.events {
+		counts[ev.Type] += 1
+	}
+	return counts
+}
+
+func TestDownloadEvents(t *testing.T) {
+	playlist := newTestStream(t, 3, func(w http.ResponseWriter, r *http.Request, seq int) {
+		if seq == 1 {
+			http.Error(w, "error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "segment %d", seq)
+	})
+
+	var rec eventRecorder
+	d := NewDownloader(playlist, t.TempDir())
+	d.OnEvent = rec.record
+
+	if err := d.Download(); err == nil {
+		t.Fatal("failed segment was not reported")
+	}
+
+	counts := rec.count()
+	want := map[DownloadEventType]int{
+		DownloadEventSegmentQueued:     3,
+		DownloadEventSegmentDownloaded: 2,
+		DownloadEventSegmentFailed:     1,
+	}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("%v events = %d, want %d", typ, counts[typ], n)
+		}
+	}
+
+	for _, ev := range rec.events {
+		switch ev.Type {
+		case DownloadEventSegmentDownloaded:
+			if want := len(fmt.Sprintf("segment %d", ev.Seq)); ev.Bytes != want {
+				t.Errorf("segment %d bytes = %d, want %d", ev.Seq, ev.Bytes, want)
+			}
+		case DownloadEventSegmentFailed:
+			if ev.Seq != 1 || ev.Err == nil {
+				t.Errorf("failed event = seq %d err %v, want seq 1 with an error", ev.Seq, ev.Err)
+			}
+		}
+	}
+}
+
+func TestDownloadEventsHalted(t *testing.T) {
+	playlist := newTestStream(t, 5, func(w http.ResponseWriter, r *http.Request, seq int) {
+		fmt.Fprintf(w, "segment %d", seq)
+	})
+
+	var rec eventRecorder
+	d := NewDownloader(playlist, t.TempDir())
+	d.Parallel = 1
+	d.OnEvent = rec.record
+	d.AddFilter(func(seq uint64, data []byte) ([]byte, bool) {
+		if seq == 0 {
+			d.Halt()
+			time.Sleep(50 * time.Millisecond)
+		}
+		return data, true
+	})
+
+	if err := d.Download(); err != ErrHalted {
+		t.Fatalf("err = %v, want %v", err, ErrHalted)
+	}
+
+	// segments not passed to the download goroutines are not reported as queued
+	counts := rec.count()
+	if queued, done := counts[DownloadEventSegmentQueued], counts[DownloadEventSegmentDownloaded]+counts[DownloadEventSegmentFailed]; queued != done {
+		t.Errorf("queued %d segments, finished %d", queued, done)
+	}
+	if counts[DownloadEventSegmentQueued] == 5 {
+		t.Error("all segments were queued after halt")
+	}
+}
+
+func TestDownloadEventsPlaylistError(t *testing.T) {
+	playlist := newTestStream(t, 0, nil)
+
+	var rec eventRecorder
+	d := NewDownloader(playlist+".missing", t.TempDir())
+	d.OnEvent = rec.record
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.StartContext(ctx, 10*time.Millisecond)
+
+	deadline := time.After(5 * time.Second)
+	for rec.count()[DownloadEventPlaylistError] == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("playlist error was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-d.Done
+}
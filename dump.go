@@ -0,0 +1,169 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	redacted = "REDACTED"
+)
+
+var (
+	redactedHeaders = []string{"Authorization", "X-Guest-Token", "X-Csrf-Token", "Cookie", "Set-Cookie"}
+	redactedBodyRe  = regexp.MustCompile(`("(?:guest_token|access_token|chat_token|auth_token|ct0)"\s*:\s*")[^"]*(")`)
+)
+
+type dumpRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type dumpResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+}
+
+type dumpEntry struct {
+	Time     time.Time     `json:"time"`
+	Duration float64       `json:"duration"`
+	Request  dumpRequest   `json:"request"`
+	Response *dumpResponse `json:"response,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// WithDebugDump writes every request and response of the Client to w as a json line,
+// with tokens and cookies redacted. It is meant to be attached to bug reports.
+func WithDebugDump(w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.dump = w
+	}
+}
+
+type dumpTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := dumpEntry{
+		Time: time.Now(),
+		Request: dumpRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+		},
+	}
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := ioutil.ReadAll(body)
+			body.Close()
+			entry.Request.Body = redactBody(b)
+		}
+	}
+
+	next := t.next
+	if next == nil {
+		next = defaultTransport()
+	}
+	resp, err := next.RoundTrip(req)
+	entry.Duration = time.Since(entry.Time).Seconds()
+	if err != nil {
+		entry.Error = err.Error()
+		t.write(&entry)
+		return nil, err
+	}
+
+	// an upgraded connection stays open, so only the handshake is dumped
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		entry.Response = &dumpResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+		}
+		t.write(&entry)
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		entry.Error = err.Error()
+		t.write(&entry)
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry.Response = &dumpResponse{
+		StatusCode: resp.StatusCode,
+		Header:     redactHeader(resp.Header),
+		Body:       redactBody(body),
+	}
+	t.write(&entry)
+
+	return resp, nil
+}
+
+func (t *dumpTransport) write(entry *dumpEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(append(b, '\n'))
+}
+
+func redactHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for _, key := range redactedHeaders {
+		if _, ok := h[key]; ok {
+			h.Set(key, redacted)
+		}
+	}
+	return h
+}
+
+func redactBody(b []byte) string {
+	return string(redactedBodyRe.ReplaceAll(b, []byte("${1}"+redacted+"${2}")))
+}
+
+func (c *Client) applyDebugDump() {
+	if c.dump == nil {
+		return
+	}
+
+	// copy so that the http.Client given by WithHTTPClient is not modified
+	client := *c.client
+	client.Transport = &dumpTransport{
+		next: c.client.Transport,
+		w:    c.dump,
+	}
+	c.client = &client
+}
@@ -0,0 +1,103 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"net/url"
+)
+
+// Endpoints are the urls of the twitter apis used by the Client.
+// They can be changed for x.com, a MITM proxy or a test server.
+type Endpoints struct {
+	// Index is the page the bundles are found from
+	Index         string
+	ServiceWorker string
+	// GuestGraphQL is the base url of the graphql apis used with a guest token
+	GuestGraphQL string
+	// GraphQL is the base url of the graphql apis used with a logged in session
+	GraphQL         string
+	GuestActivate   string
+	LiveVideoStream string
+	AvatarContent   string
+}
+
+var (
+	DefaultEndpoints = Endpoints{
+		Index:           "https://twitter.com/",
+		ServiceWorker:   "https://twitter.com/sw.js",
+		GuestGraphQL:    "https://api.twitter.com/graphql",
+		GraphQL:         "https://twitter.com/i/api/graphql",
+		GuestActivate:   "https://api.twitter.com/1.1/guest/activate.json",
+		LiveVideoStream: "https://twitter.com/i/api/1.1/live_video_stream/status",
+		AvatarContent:   "https://twitter.com/i/api/fleets/v1/avatar_content",
+	}
+
+	// XEndpoints are DefaultEndpoints on x.com
+	XEndpoints = Endpoints{
+		Index:           "https://x.com/",
+		ServiceWorker:   "https://x.com/sw.js",
+		GuestGraphQL:    "https://api.x.com/graphql",
+		GraphQL:         "https://x.com/i/api/graphql",
+		GuestActivate:   "https://api.x.com/1.1/guest/activate.json",
+		LiveVideoStream: "https://x.com/i/api/1.1/live_video_stream/status",
+		AvatarContent:   "https://x.com/i/api/fleets/v1/avatar_content",
+	}
+)
+
+// WithEndpoints changes the urls of the twitter apis, empty fields are left as DefaultEndpoints.
+// Base urls are given without a trailing slash.
+// The session cookies are sent to the hosts of the endpoints in addition to twitter.com and x.com.
+func WithEndpoints(endpoints Endpoints) ClientOption {
+	return func(c *Client) {
+		e := &c.endpoints
+		for _, f := range []struct {
+			dst *string
+			src string
+		}{
+			{&e.Index, endpoints.Index},
+			{&e.ServiceWorker, endpoints.ServiceWorker},
+			{&e.GuestGraphQL, endpoints.GuestGraphQL},
+			{&e.GraphQL, endpoints.GraphQL},
+			{&e.GuestActivate, endpoints.GuestActivate},
+			{&e.LiveVideoStream, endpoints.LiveVideoStream},
+			{&e.AvatarContent, endpoints.AvatarContent},
+		} {
+			if f.src != "" {
+				*f.dst = f.src
+			}
+		}
+	}
+}
+
+// Endpoints returns the urls of the twitter apis used by the Client
+func (c *Client) Endpoints() Endpoints {
+	return c.endpoints
+}
+
+// isSessionHost reports whether the session cookies and headers can be sent to the host
+func (c *Client) isSessionHost(host string) bool {
+	if isTwitterHost(host) {
+		return true
+	}
+	e := c.endpoints
+	for _, u := range []string{e.Index, e.GuestGraphQL, e.GraphQL, e.GuestActivate, e.LiveVideoStream, e.AvatarContent} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	ClassificationNotFound     = "NotFound"
+	ClassificationSuspended    = "Suspended"
+	ClassificationProtected    = "Protected"
+	ClassificationOverCapacity = "OverCapacity"
+	ClassificationAuthRequired = "AuthRequired"
+	ClassificationRateLimited  = "RateLimited"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrSuspended    = errors.New("account suspended")
+	ErrProtected    = errors.New("account protected")
+	ErrOverCapacity = errors.New("over capacity")
+	ErrAuthRequired = errors.New("login required")
+	ErrRateLimited  = errors.New("rate limited")
+
+	// space state errors, ErrSpaceNotFound and ErrProtectedSpace are the same as ErrNotFound and ErrProtected
+	ErrSpaceNotFound   = ErrNotFound
+	ErrProtectedSpace  = ErrProtected
+	ErrSpaceNotStarted = errors.New("space has not started yet")
+	ErrSpaceEnded      = errors.New("space has ended and the replay is not available")
+	ErrSpaceCanceled   = errors.New("space was canceled")
+	ErrRestrictedSpace = errors.New("space is restricted")
+	ErrTicketedSpace   = errors.New("space is ticketed")
+)
+
+var (
+	classificationErrors = map[string]error{
+		ClassificationNotFound:     ErrNotFound,
+		ClassificationSuspended:    ErrSuspended,
+		ClassificationProtected:    ErrProtected,
+		ClassificationOverCapacity: ErrOverCapacity,
+		ClassificationAuthRequired: ErrAuthRequired,
+		ClassificationRateLimited:  ErrRateLimited,
+	}
+
+	classificationHints = map[string]string{
+		ClassificationNotFound:     "the space or user does not exist, or it was deleted",
+		ClassificationSuspended:    "the host account is suspended",
+		ClassificationProtected:    "the host account is protected, and cannot be accessed without login",
+		ClassificationOverCapacity: "twitter is over capacity, try again later",
+		ClassificationAuthRequired: "login is required, use a logged in session",
+		ClassificationRateLimited:  "the rate limit is exceeded, try again later",
+	}
+
+	// legacy error codes of twitter api
+	errorCodeClassifications = map[int]string{
+		34:  ClassificationNotFound,
+		50:  ClassificationNotFound,
+		63:  ClassificationSuspended,
+		64:  ClassificationSuspended,
+		88:  ClassificationRateLimited,
+		215: ClassificationAuthRequired,
+		220: ClassificationAuthRequired,
+		130: ClassificationOverCapacity,
+		179: ClassificationProtected,
+	}
+)
+
+// Classification returns the classification of the first recognized error, or empty string
+func (q *QueryError) Classification() string {
+	for _, e := range q.Errors {
+		if c := classify(e.Extensions.Classification); c != "" {
+			return c
+		}
+		if c := classify(e.Extensions.Kind); c != "" {
+			return c
+		}
+		if c, ok := errorCodeClassifications[e.Extensions.Code]; ok {
+			return c
+		}
+		if c, ok := errorCodeClassifications[e.Code]; ok {
+			return c
+		}
+	}
+
+	switch q.StatusCode {
+	case http.StatusNotFound:
+		return ClassificationNotFound
+	case http.StatusServiceUnavailable:
+		return ClassificationOverCapacity
+	case http.StatusUnauthorized:
+		return ClassificationAuthRequired
+	case http.StatusTooManyRequests:
+		return ClassificationRateLimited
+	}
+
+	return ""
+}
+
+// Hint returns a human readable explanation of the error, or empty string
+func (q *QueryError) Hint() string {
+	return classificationHints[q.Classification()]
+}
+
+// Unwrap allows errors.Is(err, ErrNotFound) and the like
+func (q *QueryError) Unwrap() error {
+	return classificationErrors[q.Classification()]
+}
+
+func classify(s string) string {
+	for c := range classificationErrors {
+		if strings.EqualFold(s, c) {
+			return c
+		}
+	}
+	return ""
+}
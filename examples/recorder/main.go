@@ -0,0 +1,176 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Command recorder is a minimal space recorder built only on the public API of spacedl.
+//
+//	go run ./examples/recorder <space_id|space_url>
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+// fileSink appends segments to a single file in playlist order instead of writing one file per segment
+type fileSink struct {
+	mu       sync.Mutex
+	f        *os.File
+	segments int
+	bytes    int64
+}
+
+func (s *fileSink) filter(seq uint64, data []byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(data); err != nil {
+		log.Printf("write error: %v", err)
+	}
+	s.segments += 1
+	s.bytes += int64(len(data))
+
+	// progress
+	fmt.Printf("\rsegments: %d, %.1f MB", s.segments, float64(s.bytes)/1024/1024)
+
+	// drop the segment, it has been written to the sink
+	return nil, false
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: recorder <space_id|space_url>")
+		os.Exit(1)
+	}
+
+	if err := record(os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func record(arg string) error {
+	spaceID, err := spacedl.ParseSpaceID(arg)
+	if err != nil {
+		return err
+	}
+
+	ffmpeg := spacedl.NewFFmpeg("")
+	if err := ffmpeg.Check(); err != nil {
+		return err
+	}
+
+	client, err := spacedl.NewClient()
+	if err != nil {
+		return err
+	}
+	if err := client.Initialize(); err != nil {
+		return err
+	}
+
+	space, err := client.GetAudioSpace(spaceID)
+	if err != nil {
+		return err
+	}
+	metadata := space.Data.AudioSpace.Metadata
+	ended := space.Status().IsFinal()
+	if ended && !metadata.IsSpaceAvailableForReplay {
+		return errors.New("space replay is not available")
+	}
+
+	stream, err := client.GetLiveVideoStream(metadata.MediaKey)
+	if err != nil {
+		return err
+	}
+	if stream.Source.Location == "" {
+		return errors.New("stream url not found")
+	}
+
+	// segments are dropped by the sink, the directory stays empty
+	tmp, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	f, err := os.Create(spaceID + ".aac")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sink := &fileSink{f: f}
+
+	dl := spacedl.NewDownloader(stream.Source.Location, tmp)
+	dl.Parallel = 1
+	dl.AddFilter(sink.filter)
+
+	// cancellation
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		dl.Halt()
+	}()
+
+	if ended {
+		// the segments downloaded until the interrupt are saved
+		if err := dl.Download(); err != nil && !errors.Is(err, spacedl.ErrHalted) {
+			return err
+		}
+	} else {
+		dl.Start(1 * time.Second)
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				if space, err := client.GetAudioSpace(spaceID); err == nil && space.Status().IsFinal() {
+					dl.Halt()
+				}
+			case <-dl.Done:
+				break loop
+			}
+		}
+	}
+	fmt.Println()
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// remux into mp4 container
+	output := spaceID + ".m4a"
+	cmd := ffmpeg.Command("-hide_banner", "-loglevel", "error", "-i", f.Name(), "-codec", "copy", "-y", output)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+
+	fmt.Printf("saved %s (%d segments)\n", output, sink.segments)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// FallbackBearerToken is the public bearer token of the web client, used when it cannot be found in the bundle
+	FallbackBearerToken = "AAAAAAAAAAAAAAAAAAAAANRILgAAAAAAnNwIzUejRCOuH5E6I8xnZz4puTs%3D1Zv7ttfk8LF81IUq16cHjhLTvJu4FA33AGWWjCpTnA"
+)
+
+// errOfflineInit is the reason of the fallback used by InitializeOffline
+var errOfflineInit = errors.New("initialized offline")
+
+// fallbackOperations is a snapshot of the operation needed to download a space, the query id may be outdated.
+// Other operations such as AudioSpaceSearch are not bundled,
+// Query returns OperationNotFoundError for them unless they are given by WithOperations.
+// GetUserSpaces does not use GraphQL and works with the fallback.
+func fallbackOperations() map[string]*Operation {
+	return map[string]*Operation{
+		"AudioSpaceById": {
+			QueryID:       "HPEisOmj1epUNLCWTYhUWw",
+			OperationName: "AudioSpaceById",
+			OperationType: "query",
+		},
+	}
+}
+
+// useFallback fills what was not found in the bundles with the fallback
+func (c *Client) useFallback(reason error) {
+	c.fallbackErr = reason
+	if c.bearerToken == "" {
+		c.bearerToken = FallbackBearerToken
+	}
+	operations := fallbackOperations()
+	for name, op := range c.operations {
+		operations[name] = op
+	}
+	c.operations = operations
+}
+
+// InitializeOffline initializes the Client with the fallback bearer token and operations
+// without downloading twitter.com and the bundles. Only the guest token is fetched.
+// WithOperations can be used to give up to date operations, and is required for SearchSpaces.
+func (c *Client) InitializeOffline() error {
+	return c.InitializeOfflineContext(context.Background())
+}
+
+func (c *Client) InitializeOfflineContext(ctx context.Context) error {
+	c.useFallback(errOfflineInit)
+
+	if !c.Authenticated() {
+		if err := c.refreshGuestToken(ctx); err != nil {
+			return err
+		}
+	}
+	c.guestTokens.start()
+
+	return nil
+}
+
+// FallbackErr returns why the fallback bearer token and operations are used,
+// or nil if they were found in the bundles or loaded from the token cache.
+func (c *Client) FallbackErr() error {
+	return c.fallbackErr
+}
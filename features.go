@@ -0,0 +1,82 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// feature switches in the initial state of twitter.com, "name":{"value":true}
+	featureValueRegexp = regexp.MustCompile(`"([a-z0-9_]+)":\{"value":(true|false)\}`)
+)
+
+// WithFeatures sets GraphQL feature flags sent with every query, taking precedence over the discovered ones.
+func WithFeatures(features map[string]bool) ClientOption {
+	return func(c *Client) {
+		if c.featureOverrides == nil {
+			c.featureOverrides = make(map[string]bool)
+		}
+		for name, value := range features {
+			c.featureOverrides[name] = value
+		}
+	}
+}
+
+func extractFeatureValues(index []byte) map[string]bool {
+	values := make(map[string]bool)
+	for _, m := range featureValueRegexp.FindAllSubmatch(index, -1) {
+		v, _ := strconv.ParseBool(string(m[2]))
+		values[string(m[1])] = v
+	}
+	return values
+}
+
+// withFeatures fills the features parameter with the feature switches required by the operation,
+// their values are taken from the initial state of twitter.com.
+func (c *Client) withFeatures(op *Operation, params []QueryParameter) []QueryParameter {
+	if len(op.FeatureSwitches) == 0 && len(c.featureOverrides) == 0 {
+		return params
+	}
+
+	features := make(map[string]interface{})
+	idx := -1
+	for i, p := range params {
+		if p.Name == "features" {
+			idx = i
+			for k, v := range p.Value {
+				features[k] = v
+			}
+		}
+	}
+	for _, name := range op.FeatureSwitches {
+		features[name] = c.featureValues[name]
+	}
+	for name, value := range c.featureOverrides {
+		features[name] = value
+	}
+
+	// params may be shared by callers, so it is not modified
+	result := append([]QueryParameter(nil), params...)
+	if idx >= 0 {
+		result[idx] = QueryParameter{Name: "features", Value: features}
+	} else {
+		result = append(result, QueryParameter{Name: "features", Value: features})
+	}
+	return result
+}
@@ -17,10 +17,91 @@
 package spacedl
 
 import (
+	"bufio"
+	"bytes"
+	"os"
 	"os/exec"
+	"strings"
 )
 
-func CheckFFmpeg() error {
-	cmd := exec.Command("ffmpeg", "-version")
+const (
+	FFmpegPathEnv = "SPACE_DL_FFMPEG"
+)
+
+type FFmpeg struct {
+	Path string
+}
+
+type Capabilities struct {
+	Muxers   map[string]bool
+	Encoders map[string]bool
+	Filters  map[string]bool
+	BSFs     map[string]bool
+}
+
+func NewFFmpeg(path string) *FFmpeg {
+	if path == "" {
+		path = os.Getenv(FFmpegPathEnv)
+	}
+	if path == "" {
+		path = "ffmpeg"
+	}
+	return &FFmpeg{
+		Path: path,
+	}
+}
+
+func (f *FFmpeg) Command(args ...string) *exec.Cmd {
+	return exec.Command(f.Path, args...)
+}
+
+func (f *FFmpeg) Check() error {
+	cmd := f.Command("-version")
 	return cmd.Run()
 }
+
+func CheckFFmpeg() error {
+	return NewFFmpeg("").Check()
+}
+
+func (f *FFmpeg) Probe() (*Capabilities, error) {
+	var caps Capabilities
+	var err error
+
+	if caps.Muxers, err = f.list("-muxers", 1); err != nil {
+		return nil, err
+	}
+	if caps.Encoders, err = f.list("-encoders", 1); err != nil {
+		return nil, err
+	}
+	if caps.Filters, err = f.list("-filters", 1); err != nil {
+		return nil, err
+	}
+	if caps.BSFs, err = f.list("-bsfs", 0); err != nil {
+		return nil, err
+	}
+
+	return &caps, nil
+}
+
+func (f *FFmpeg) list(option string, column int) (map[string]bool, error) {
+	cmd := f.Command("-hide_banner", option)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) <= column {
+			continue
+		}
+		for _, name := range strings.Split(fields[column], ",") {
+			names[name] = true
+		}
+	}
+
+	return names, scanner.Err()
+}
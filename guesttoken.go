@@ -0,0 +1,215 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultGuestTokenTTL is the assumed lifetime of a guest token
+	DefaultGuestTokenTTL = 2 * time.Hour
+
+	// tokens older than this fraction of the ttl are replaced in the background
+	guestTokenRefreshRatio = 0.75
+	guestTokenFetchTimeout = 30 * time.Second
+)
+
+// WithGuestTokenPool keeps size guest tokens, which are used in turn and replaced before ttl in the background.
+// A token rejected as a bad guest token is discarded and the request is retried with another one.
+// Tokens do not expire if ttl is 0.
+func WithGuestTokenPool(size int, ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		if size < 1 {
+			size = 1
+		}
+		c.guestTokens.size = size
+		c.guestTokens.ttl = ttl
+	}
+}
+
+type guestToken struct {
+	value     string
+	fetchedAt time.Time
+}
+
+type guestTokenPool struct {
+	mu         sync.Mutex
+	tokens     []guestToken
+	current    int
+	size       int
+	ttl        time.Duration
+	refreshing bool
+	// started is set when the bearer token is known, tokens are not fetched in the background before that
+	started bool
+}
+
+func newGuestTokenPool() *guestTokenPool {
+	return &guestTokenPool{
+		size: 1,
+		ttl:  DefaultGuestTokenTTL,
+	}
+}
+
+// peek returns the token which will be used next, or empty string
+func (p *guestTokenPool) peek() string {
+	t, _ := p.peekToken()
+	return t.value
+}
+
+func (p *guestTokenPool) peekToken() (guestToken, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.tokens) == 0 {
+		return guestToken{}, false
+	}
+	return p.tokens[p.current%len(p.tokens)], true
+}
+
+func (p *guestTokenPool) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started = true
+}
+
+func (p *guestTokenPool) add(value string, fetchedAt time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tokens = append(p.tokens, guestToken{value: value, fetchedAt: fetchedAt})
+}
+
+// remove discards the token, and reports whether a token is left
+func (p *guestTokenPool) remove(value string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, t := range p.tokens {
+		if t.value == value {
+			p.tokens = append(p.tokens[:i], p.tokens[i+1:]...)
+			break
+		}
+	}
+	return len(p.tokens) > 0
+}
+
+// needsRefresh reports whether the pool is not full or has stale tokens, and marks it as refreshing
+func (p *guestTokenPool) needsRefresh(now time.Time) bool {
+	if !p.started || p.refreshing {
+		return false
+	}
+	stale := len(p.tokens) < p.size
+	for _, t := range p.tokens {
+		if p.isStale(t, now) {
+			stale = true
+		}
+	}
+	p.refreshing = stale
+	return stale
+}
+
+func (p *guestTokenPool) isStale(t guestToken, now time.Time) bool {
+	return p.ttl > 0 && now.Sub(t.fetchedAt) >= time.Duration(float64(p.ttl)*guestTokenRefreshRatio)
+}
+
+// guestToken returns the guest token for a request, and starts refreshing the pool in the background if needed
+func (c *Client) guestToken() string {
+	p := c.guestTokens
+	now := c.clock.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.needsRefresh(now) {
+		go c.fillGuestTokens()
+	}
+
+	// expired tokens are skipped, but the last one is used until it is replaced
+	var token string
+	for n := 0; n < len(p.tokens); n++ {
+		t := p.tokens[p.current%len(p.tokens)]
+		p.current = (p.current + 1) % len(p.tokens)
+		token = t.value
+		if p.ttl <= 0 || now.Sub(t.fetchedAt) < p.ttl {
+			break
+		}
+	}
+	return token
+}
+
+// fillGuestTokens fetches tokens until the pool is full, then replaces the stale tokens
+func (c *Client) fillGuestTokens() {
+	p := c.guestTokens
+	defer func() {
+		p.mu.Lock()
+		p.refreshing = false
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), guestTokenFetchTimeout)
+	defer cancel()
+
+	for {
+		now := c.clock.Now()
+		p.mu.Lock()
+		var stale []string
+		for _, t := range p.tokens {
+			if p.isStale(t, now) {
+				stale = append(stale, t.value)
+			}
+		}
+		fresh := len(p.tokens) - len(stale)
+		p.mu.Unlock()
+		if fresh >= p.size {
+			return
+		}
+
+		token, err := c.getGuestToken(ctx)
+		if err != nil {
+			c.print("guest token refresh error: %v", err)
+			return
+		}
+		p.add(token, c.clock.Now())
+
+		// the oldest stale token is replaced by the new one
+		if len(stale) > 0 {
+			p.remove(stale[0])
+		}
+	}
+}
+
+func (c *Client) refreshGuestToken(ctx context.Context) error {
+	token, err := c.getGuestToken(ctx)
+	if err != nil {
+		return err
+	}
+	c.guestTokens.add(token, c.clock.Now())
+	return nil
+}
+
+// discardGuestToken drops a token rejected by twitter, a new token is fetched if none is left
+func (c *Client) discardGuestToken(ctx context.Context, token string) error {
+	c.print("bad guest token, switching guest token")
+	if c.guestTokens.remove(token) {
+		return nil
+	}
+	return c.refreshGuestToken(ctx)
+}
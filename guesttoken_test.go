@@ -0,0 +1,83 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestInitializeActivatesGuestTokenOnce(t *testing.T) {
+	const bearer = "AAAAAAAAAAAAAAAAAAAAAfixturebearertoken0123456789abcdef"
+
+	var mu sync.Mutex
+	var activations []string
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<script src="%s/main.fixture.js"></script>`, server.URL)
+		case "/main.fixture.js":
+			fmt.Fprintf(w, `var a="%s";`, bearer)
+		case "/activate.json":
+			mu.Lock()
+			activations = append(activations, r.Header.Get("Authorization"))
+			n := len(activations)
+			mu.Unlock()
+			fmt.Fprintf(w, `{"guest_token":"%d"}`, n)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithTransport(server.Client().Transport),
+		WithEndpoints(Endpoints{
+			Index:         server.URL + "/",
+			ServiceWorker: server.URL + "/sw.js",
+			GuestActivate: server.URL + "/activate.json",
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.BearerToken(); got != bearer {
+		t.Fatalf("bearer token = %q, want %q", got, bearer)
+	}
+	server.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(activations) != 1 {
+		t.Fatalf("guest token activated %d times, want 1", len(activations))
+	}
+	if activations[0] != "Bearer "+bearer {
+		t.Errorf("activation authorization = %q, want the scraped bearer token", activations[0])
+	}
+	if got := client.GuestToken(); got != "1" {
+		t.Errorf("guest token = %q, want %q", got, "1")
+	}
+}
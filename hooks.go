@@ -0,0 +1,208 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RequestInfo describes a finished request, it is passed to Hooks.RequestFinished
+type RequestInfo struct {
+	Method string
+	URL    *url.URL
+	// Attempt starts from 1, and is incremented by retries
+	Attempt    int
+	StatusCode int
+	// Err is the error of the request or of reading the body
+	Err error
+	// Duration is the time until the body is closed
+	Duration time.Duration
+	// Bytes is the size of the body read
+	Bytes int64
+	// Timing is set if Hooks.Trace is enabled
+	Timing *RequestTiming
+}
+
+// RequestTiming is the breakdown of a request traced by net/http/httptrace.
+// DNS, Connect and TLS are zero if an idle connection was reused.
+type RequestTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TTFB is the time from the start of the request until the first byte of the response
+	TTFB       time.Duration
+	ConnReused bool
+}
+
+// Hooks are called for each request sent by the Client or the Downloader, to export metrics without wrapping the transport.
+type Hooks struct {
+	RequestStarted  func(req *http.Request, attempt int)
+	RequestFinished func(info RequestInfo)
+	// Trace sets RequestInfo.Timing, to tell whether slow requests are spent on the network or on the server
+	Trace bool
+}
+
+func WithHooks(hooks Hooks) ClientOption {
+	return func(c *Client) {
+		c.hooks = hooks
+	}
+}
+
+// send sends the request once, calling the hooks
+func (c *Client) send(req *http.Request, attempt int) (*http.Response, error) {
+	c.setDefaultHeaders(req)
+	// a new id is required for each request
+	if err := c.setTransactionID(req); err != nil {
+		return nil, err
+	}
+
+	return sendWithHooks(c.client, c.hooks, req, attempt)
+}
+
+// sendWithHooks sends the request by the client, calling the hooks
+func sendWithHooks(client *http.Client, hooks Hooks, req *http.Request, attempt int) (*http.Response, error) {
+	if hooks.RequestStarted != nil {
+		hooks.RequestStarted(req, attempt)
+	}
+
+	var trace *requestTrace
+	if hooks.Trace && hooks.RequestFinished != nil {
+		trace = &requestTrace{}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if hooks.RequestFinished == nil {
+		return resp, err
+	}
+
+	info := RequestInfo{
+		Method:  req.Method,
+		URL:     req.URL,
+		Attempt: attempt,
+	}
+	if trace != nil {
+		info.Timing = trace.timing(start)
+	}
+	if err != nil {
+		info.Err = err
+		info.Duration = time.Since(start)
+		hooks.RequestFinished(info)
+		return nil, err
+	}
+
+	info.StatusCode = resp.StatusCode
+	resp.Body = &hookedBody{
+		body:     resp.Body,
+		info:     info,
+		start:    start,
+		finished: hooks.RequestFinished,
+	}
+	return resp, nil
+}
+
+// requestTrace records the times of the httptrace events, which may be called from other goroutines
+type requestTrace struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	set := func(p *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if p.IsZero() {
+			*p = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:      func(string, string) { set(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart: func() { set(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		GotFirstResponseByte: func() {
+			set(&t.firstByte)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+		},
+	}
+}
+
+func (t *requestTrace) timing(start time.Time) *RequestTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	between := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return to.Sub(from)
+	}
+	return &RequestTiming{
+		DNS:        between(t.dnsStart, t.dnsDone),
+		Connect:    between(t.connectStart, t.connectDone),
+		TLS:        between(t.tlsStart, t.tlsDone),
+		TTFB:       between(start, t.firstByte),
+		ConnReused: t.reused,
+	}
+}
+
+// hookedBody counts the bytes read, and calls the finished hook when closed
+type hookedBody struct {
+	body     io.ReadCloser
+	info     RequestInfo
+	start    time.Time
+	finished func(info RequestInfo)
+	once     sync.Once
+}
+
+func (b *hookedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.info.Bytes += int64(n)
+	if err != nil && err != io.EOF && b.info.Err == nil {
+		b.info.Err = err
+	}
+	return n, err
+}
+
+func (b *hookedBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() {
+		b.info.Duration = time.Since(b.start)
+		b.finished(b.info)
+	})
+	return err
+}
@@ -17,8 +17,13 @@
 package spacedl
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type keyValue struct {
@@ -26,8 +31,15 @@ type keyValue struct {
 	value string
 }
 
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
 type Metadata struct {
-	kvs []keyValue
+	kvs      []keyValue
+	chapters []Chapter
 }
 
 func (m *Metadata) Add(k, v string) {
@@ -37,11 +49,54 @@ func (m *Metadata) Add(k, v string) {
 	})
 }
 
+func (m *Metadata) Set(k, v string) {
+	for i := range m.kvs {
+		if m.kvs[i].key == k {
+			m.kvs[i].value = v
+			return
+		}
+	}
+	m.Add(k, v)
+}
+
+func (m *Metadata) Get(k string) (string, bool) {
+	for _, kv := range m.kvs {
+		if kv.key == k {
+			return kv.value, true
+		}
+	}
+	return "", false
+}
+
+func (m *Metadata) Clone() *Metadata {
+	return &Metadata{
+		kvs:      append([]keyValue(nil), m.kvs...),
+		chapters: append([]Chapter(nil), m.chapters...),
+	}
+}
+
+func (m *Metadata) Chapters() []Chapter {
+	return m.chapters
+}
+
+func (m *Metadata) AddChapter(c Chapter) {
+	m.chapters = append(m.chapters, c)
+}
+
+func (m *Metadata) ClearChapters() {
+	m.chapters = nil
+}
+
 func (m *Metadata) String() string {
 	s := ";FFMETADATA1\n"
 	for _, kv := range m.kvs {
 		s += fmt.Sprintf("%s=%s\n", escape(kv.key), escape(kv.value))
 	}
+	for _, c := range m.chapters {
+		s += "[CHAPTER]\nTIMEBASE=1/1000\n"
+		s += fmt.Sprintf("START=%d\nEND=%d\n", c.Start.Milliseconds(), c.End.Milliseconds())
+		s += fmt.Sprintf("title=%s\n", escape(c.Title))
+	}
 	return s
 }
 
@@ -49,3 +104,139 @@ func escape(s string) string {
 	rep := strings.NewReplacer(`=`, `\=`, `;`, `\;`, `#`, `\#`, "\n", "\\\n")
 	return rep.Replace(s)
 }
+
+type metadataLine struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+func ParseMetadata(r io.Reader) (*Metadata, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	src := string(b)
+	if !strings.HasPrefix(src, ";FFMETADATA1") {
+		return nil, errors.New("invalid metadata header")
+	}
+
+	var m Metadata
+	var chapter *Chapter
+	num, den := int64(1), int64(1000000000)
+	var start, end int64
+
+	flushChapter := func() {
+		if chapter != nil {
+			chapter.Start = time.Duration(start * num * int64(time.Second) / den)
+			chapter.End = time.Duration(end * num * int64(time.Second) / den)
+			m.chapters = append(m.chapters, *chapter)
+			chapter = nil
+		}
+	}
+
+	for _, line := range splitMetadataLines(src) {
+		if !line.hasValue {
+			section := strings.TrimSpace(line.key)
+			if strings.HasPrefix(section, "[") {
+				flushChapter()
+				if section == "[CHAPTER]" {
+					chapter = &Chapter{}
+					num, den = 1, 1000000000
+					start, end = 0, 0
+				}
+			}
+			continue
+		}
+
+		if chapter == nil {
+			m.Add(line.key, line.value)
+			continue
+		}
+
+		switch line.key {
+		case "TIMEBASE":
+			n, d, ok := strings.Cut(line.value, "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid timebase: %s", line.value)
+			}
+			if num, err = strconv.ParseInt(n, 10, 64); err != nil {
+				return nil, err
+			}
+			if den, err = strconv.ParseInt(d, 10, 64); err != nil || den == 0 {
+				return nil, fmt.Errorf("invalid timebase: %s", line.value)
+			}
+		case "START":
+			if start, err = strconv.ParseInt(line.value, 10, 64); err != nil {
+				return nil, err
+			}
+		case "END":
+			if end, err = strconv.ParseInt(line.value, 10, 64); err != nil {
+				return nil, err
+			}
+		case "title":
+			chapter.Title = line.value
+		}
+	}
+	flushChapter()
+
+	return &m, nil
+}
+
+func splitMetadataLines(src string) []metadataLine {
+	var lines []metadataLine
+	var key, value strings.Builder
+	inValue := false
+	lineStart := true
+	comment := false
+
+	emit := func() {
+		if !comment && (inValue || key.Len() > 0) {
+			lines = append(lines, metadataLine{
+				key:      key.String(),
+				value:    value.String(),
+				hasValue: inValue,
+			})
+		}
+		key.Reset()
+		value.Reset()
+		inValue = false
+		lineStart = true
+		comment = false
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if lineStart {
+			lineStart = false
+			if c == ';' || c == '#' {
+				comment = true
+			}
+		}
+
+		switch {
+		case c == '\\' && i+1 < len(src):
+			i++
+			c = src[i]
+		case c == '\n':
+			emit()
+			continue
+		case c == '=' && !inValue:
+			inValue = true
+			continue
+		}
+
+		if comment {
+			continue
+		}
+		if inValue {
+			value.WriteByte(c)
+		} else {
+			key.WriteByte(c)
+		}
+	}
+	emit()
+
+	return lines
+}
@@ -0,0 +1,117 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WithOperations adds GraphQL operations which take precedence over the ones found in the bundle.
+// Initialize succeeds even if no operation is found in the bundle when operations are given.
+func WithOperations(operations []*Operation) ClientOption {
+	return func(c *Client) {
+		if c.operationOverrides == nil {
+			c.operationOverrides = make(map[string]*Operation)
+		}
+		for _, op := range operations {
+			c.operationOverrides[op.OperationName] = op
+		}
+	}
+}
+
+// ReadOperations reads operations from json, either an object of operation name to query id
+// or an array of objects with queryId, operationName and operationType.
+func ReadOperations(r io.Reader) ([]*Operation, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var ids map[string]string
+	if err := json.Unmarshal(raw, &ids); err == nil {
+		operations := make([]*Operation, 0, len(ids))
+		for name, id := range ids {
+			if id == "" {
+				return nil, fmt.Errorf("query id of %s is empty", name)
+			}
+			operations = append(operations, &Operation{
+				QueryID:       id,
+				OperationName: name,
+				OperationType: "query",
+			})
+		}
+		return operations, nil
+	}
+
+	var list []struct {
+		QueryID       string `json:"queryId"`
+		OperationName string `json:"operationName"`
+		OperationType string `json:"operationType"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.New("operations must be an object of name to query id, or an array of operations")
+	}
+
+	operations := make([]*Operation, 0, len(list))
+	for _, v := range list {
+		if v.QueryID == "" || v.OperationName == "" {
+			return nil, errors.New("queryId and operationName are required")
+		}
+		if v.OperationType == "" {
+			v.OperationType = "query"
+		}
+		operations = append(operations, &Operation{
+			QueryID:       v.QueryID,
+			OperationName: v.OperationName,
+			OperationType: v.OperationType,
+		})
+	}
+
+	return operations, nil
+}
+
+// ErrOperationNotFound is matched by OperationNotFoundError with errors.Is
+var ErrOperationNotFound = errors.New("operation not found")
+
+// OperationNotFoundError is returned by Query when the operation was neither found in the bundles nor given by WithOperations.
+type OperationNotFoundError struct {
+	Name string
+	// Fallback is the reason the fallback operations are used, which only contain AudioSpaceById
+	Fallback error
+}
+
+func (e *OperationNotFoundError) Error() string {
+	if e.Fallback != nil {
+		return fmt.Sprintf("operation not found: %s, the fallback operations are used (%v), give it by WithOperations", e.Name, e.Fallback)
+	}
+	return fmt.Sprintf("operation not found: %s", e.Name)
+}
+
+func (e *OperationNotFoundError) Is(target error) bool {
+	return target == ErrOperationNotFound
+}
+
+func (c *Client) operation(name string) (*Operation, bool) {
+	if op, ok := c.operationOverrides[name]; ok {
+		return op, true
+	}
+	op, ok := c.operations[name]
+	return op, ok
+}
@@ -0,0 +1,165 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Pager pages through a cursor based GraphQL query.
+//
+//	pager := client.NewPager("UserTweets", params)
+//	for pager.Next(ctx) {
+//		var resp UserTweetsResponse
+//		if err := pager.Decode(&resp); err != nil { ... }
+//	}
+//	if err := pager.Err(); err != nil { ... }
+type Pager struct {
+	// Cursor is the cursor of the next page, it can be set to resume paging
+	Cursor string
+	// CursorFunc returns the cursor of the page after the given one, FindBottomCursor by default
+	CursorFunc func(page []byte) string
+	// MaxPages stops paging after the number of pages if it is greater than 0
+	MaxPages int
+
+	client *Client
+	name   string
+	params []QueryParameter
+	page   json.RawMessage
+	pages  int
+	done   bool
+	err    error
+}
+
+// NewPager returns a Pager of the query, the cursor is set to the "cursor" variable of params
+func (c *Client) NewPager(name string, params []QueryParameter) *Pager {
+	return &Pager{
+		CursorFunc: FindBottomCursor,
+		client:     c,
+		name:       name,
+		params:     params,
+	}
+}
+
+// Next fetches the next page, and reports whether there is one
+func (p *Pager) Next(ctx context.Context) bool {
+	if p.done || p.err != nil || (p.MaxPages > 0 && p.pages >= p.MaxPages) {
+		return false
+	}
+
+	var page json.RawMessage
+	if err := p.client.QueryContext(ctx, p.name, p.paramsWithCursor(), &page); err != nil {
+		p.err = err
+		return false
+	}
+	p.page = page
+	p.pages++
+
+	// an empty or repeated cursor is the end
+	next := p.CursorFunc(page)
+	if next == "" || next == p.Cursor {
+		p.done = true
+	}
+	p.Cursor = next
+
+	return true
+}
+
+// Page returns the raw json of the current page
+func (p *Pager) Page() []byte {
+	return p.page
+}
+
+// Decode decodes the current page into out
+func (p *Pager) Decode(out interface{}) error {
+	return json.Unmarshal(p.page, out)
+}
+
+func (p *Pager) Err() error {
+	return p.err
+}
+
+func (p *Pager) paramsWithCursor() []QueryParameter {
+	if p.Cursor == "" {
+		return p.params
+	}
+
+	params := make([]QueryParameter, 0, len(p.params)+1)
+	found := false
+	for _, param := range p.params {
+		if param.Name == "variables" {
+			variables := make(map[string]interface{}, len(param.Value)+1)
+			for k, v := range param.Value {
+				variables[k] = v
+			}
+			variables["cursor"] = p.Cursor
+			param = QueryParameter{Name: param.Name, Value: variables}
+			found = true
+		}
+		params = append(params, param)
+	}
+	if !found {
+		params = append(params, QueryParameter{
+			Name:  "variables",
+			Value: map[string]interface{}{"cursor": p.Cursor},
+		})
+	}
+	return params
+}
+
+// FindBottomCursor returns the value of a timeline cursor entry of type "Bottom" in the page,
+// or the "next_cursor" field if there is no such entry.
+func FindBottomCursor(page []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(page, &v); err != nil {
+		return ""
+	}
+
+	var next string
+	var walk func(v interface{}) string
+	walk = func(v interface{}) string {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if t, _ := v["cursorType"].(string); t == "Bottom" {
+				if value, ok := v["value"].(string); ok {
+					return value
+				}
+			}
+			if value, ok := v["next_cursor"].(string); ok && next == "" {
+				next = value
+			}
+			for _, child := range v {
+				if c := walk(child); c != "" {
+					return c
+				}
+			}
+		case []interface{}:
+			for _, child := range v {
+				if c := walk(child); c != "" {
+					return c
+				}
+			}
+		}
+		return ""
+	}
+
+	if c := walk(v); c != "" {
+		return c
+	}
+	return next
+}
@@ -0,0 +1,115 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Rotation is how proxies or accounts are switched
+type Rotation int
+
+type ProxyRotation = Rotation
+
+const (
+	// RotatePerRequest uses the proxies or accounts in turn for each request
+	RotatePerRequest Rotation = iota
+	// RotateOnRateLimit keeps using a proxy or an account until a rate limit is hit
+	RotateOnRateLimit
+)
+
+// WithProxies sends the requests through the proxies, rotating them by rotation.
+// It cannot be used with a custom RoundTripper other than *http.Transport.
+func WithProxies(proxies []*url.URL, rotation ProxyRotation) ClientOption {
+	return func(c *Client) {
+		c.proxies = &proxyPool{
+			proxies:  proxies,
+			rotation: rotation,
+		}
+	}
+}
+
+type proxyPool struct {
+	mu       sync.Mutex
+	proxies  []*url.URL
+	rotation ProxyRotation
+	current  int
+}
+
+func (p *proxyPool) proxy(*http.Request) (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u := p.proxies[p.current]
+	if p.rotation == RotatePerRequest {
+		p.current = (p.current + 1) % len(p.proxies)
+	}
+	return u, nil
+}
+
+// rotateOnRateLimit switches to the next proxy, and reports whether the request should be retried through it
+func (p *proxyPool) rotateOnRateLimit() bool {
+	if p == nil || p.rotation != RotateOnRateLimit || len(p.proxies) < 2 {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = (p.current + 1) % len(p.proxies)
+	return true
+}
+
+func (c *Client) applyProxies() error {
+	if c.proxies == nil {
+		return nil
+	}
+	if len(c.proxies.proxies) == 0 {
+		return errors.New("no proxies")
+	}
+
+	var transport *http.Transport
+	switch t := c.client.Transport.(type) {
+	case nil:
+		dt, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return errors.New("proxies cannot be used with a custom transport")
+		}
+		transport = dt.Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return errors.New("proxies cannot be used with a custom transport")
+	}
+	transport.Proxy = c.proxies.proxy
+
+	// copy so that the http.Client given by WithHTTPClient is not modified
+	client := *c.client
+	client.Transport = transport
+	c.client = &client
+
+	return nil
+}
+
+func (p *proxyPool) size() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.proxies)
+}
@@ -0,0 +1,110 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithQueryCache caches the successful responses of the graphql queries in memory for ttl,
+// so that the same query made by several monitors is sent once.
+// Only the given operations are cached, or all queries if none is given.
+func WithQueryCache(ttl time.Duration, operationNames ...string) ClientOption {
+	return func(c *Client) {
+		c.queryCache = &queryCache{
+			ttl:     ttl,
+			entries: make(map[string]queryCacheEntry),
+		}
+		if len(operationNames) > 0 {
+			c.queryCache.operations = make(map[string]bool)
+			for _, name := range operationNames {
+				c.queryCache.operations[name] = true
+			}
+		}
+	}
+}
+
+type queryCacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+type queryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	operations map[string]bool
+	entries    map[string]queryCacheEntry
+}
+
+func (q *queryCache) enabled(name string) bool {
+	return q != nil && q.ttl > 0 && (q.operations == nil || q.operations[name])
+}
+
+func (q *queryCache) get(key string, now time.Time) ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(q.entries, key)
+		return nil, false
+	}
+	return e.body, true
+}
+
+func (q *queryCache) put(key string, body []byte, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// expired entries are dropped so that the cache of a long running daemon does not grow
+	for k, e := range q.entries {
+		if !now.Before(e.expires) {
+			delete(q.entries, k)
+		}
+	}
+	q.entries[key] = queryCacheEntry{
+		body:    body,
+		expires: now.Add(q.ttl),
+	}
+}
+
+// ClearQueryCache drops the cached responses
+func (c *Client) ClearQueryCache() {
+	if c.queryCache == nil {
+		return
+	}
+	c.queryCache.mu.Lock()
+	defer c.queryCache.mu.Unlock()
+	c.queryCache.entries = make(map[string]queryCacheEntry)
+}
+
+// parseCachedResponse is parseResponse reading the cached body
+func parseCachedResponse(body []byte, out interface{}) error {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	return parseResponse(resp, out)
+}
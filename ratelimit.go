@@ -0,0 +1,155 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// used when a 429 response has neither x-rate-limit-reset nor retry-after
+	defaultRateLimitWait = time.Minute
+	maxRateLimitRetries  = 3
+)
+
+// RateLimitError is returned when the rate limit of an endpoint is exceeded,
+// and waiting for the reset is not allowed by WithRateLimitWait.
+type RateLimitError struct {
+	Endpoint  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded: %s, reset at %s", e.Endpoint, e.Reset.Format(time.RFC3339))
+}
+
+// Unwrap allows errors.Is(err, ErrRateLimited)
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryAfter returns the duration until the rate limit is reset
+func (e *RateLimitError) RetryAfter() time.Duration {
+	d := time.Until(e.Reset)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// WithRateLimitWait lets the Client sleep until the rate limit is reset if it is within max,
+// otherwise a RateLimitError is returned.
+func WithRateLimitWait(max time.Duration) ClientOption {
+	return func(c *Client) {
+		c.rateLimitWait = max
+	}
+}
+
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// rateLimits keeps the last rate limit status of each endpoint
+type rateLimits struct {
+	mu     sync.Mutex
+	limits map[string]rateLimit
+}
+
+func newRateLimits() *rateLimits {
+	return &rateLimits{
+		limits: make(map[string]rateLimit),
+	}
+}
+
+// exceeded returns an error if the endpoint has no remaining requests until the reset
+func (r *rateLimits) exceeded(endpoint string, now time.Time) *RateLimitError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.limits[endpoint]
+	if !ok || l.remaining > 0 || !now.Before(l.reset) {
+		return nil
+	}
+	return &RateLimitError{
+		Endpoint:  endpoint,
+		Limit:     l.limit,
+		Remaining: l.remaining,
+		Reset:     l.reset,
+	}
+}
+
+// update records the rate limit headers of the response
+func (r *rateLimits) update(endpoint string, resp *http.Response, now time.Time) {
+	l := rateLimit{limit: -1, remaining: -1}
+	if v, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Limit")); err == nil {
+		l.limit = v
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining")); err == nil {
+		l.remaining = v
+	}
+	if v, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64); err == nil {
+		l.reset = time.Unix(v, 0)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.remaining = 0
+		if v, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			l.reset = now.Add(time.Duration(v) * time.Second)
+		} else if l.reset.IsZero() {
+			l.reset = now.Add(defaultRateLimitWait)
+		}
+	} else if l.remaining < 0 || l.reset.IsZero() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits[endpoint] = l
+}
+
+// waitRateLimit sleeps until the rate limit of the endpoint is reset, or returns RateLimitError
+func (c *Client) waitRateLimit(ctx context.Context, endpoint string) error {
+	now := c.clock.Now()
+	e := c.rateLimits.exceeded(endpoint, now)
+	if e == nil {
+		return nil
+	}
+
+	d := e.Reset.Sub(now)
+	if d > c.rateLimitWait {
+		return e
+	}
+	c.print("rate limit exceeded: %s, waiting %v", endpoint, d.Round(time.Second))
+
+	timer := c.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
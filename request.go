@@ -0,0 +1,56 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Do sends a request to an endpoint of twitter which is not wrapped by the Client,
+// with the bearer token and the logged in session or the guest token.
+// Proxies, accounts, retries and rate limits are handled as for the other requests.
+// The bearer token, the session cookies and the guest token are only sent to the twitter and x.com hosts
+// and the hosts of the Endpoints, a request to another host is sent without credentials.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.doAuthenticated(req.Context(), req)
+}
+
+// Get sends a GET request by Do and decodes the json response into out.
+// A *QueryError is returned for the errors of the response, as Query does.
+func (c *Client) Get(ctx context.Context, u string, query url.Values, out interface{}) error {
+	var q *url.Values
+	if query != nil {
+		q = &query
+	}
+	resp, err := c.get(ctx, u, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = parseResponse(resp, out)
+	if _, ok := err.(*QueryError); err != nil && !ok && resp.StatusCode/100 != 2 {
+		// the body of an error is not always json
+		return &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+	return err
+}
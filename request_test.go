@@ -0,0 +1,65 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDoCredentialsHost(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		opts  []ClientOption
+		creds bool
+	}{
+		{"third party host", nil, false},
+		{"configured endpoint", []ClientOption{WithEndpoints(Endpoints{GraphQL: server.URL + "/graphql"})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(append(tt.opts, WithSession("auth", "csrf"))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.bearerToken = "bearer"
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/api", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			for _, key := range []string{"Authorization", "X-Csrf-Token", "Cookie"} {
+				if sent := got.Get(key) != ""; sent != tt.creds {
+					t.Errorf("%s sent = %v, want %v", key, sent, tt.creds)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+const (
+	NarrowCastSpaceTypePublic = 0
+
+	// community role of the current user when they have not joined the community
+	CommunityRoleNonMember = "NonMember"
+)
+
+// RestrictedSpaceError is returned when the space is limited to an audience the credentials may not belong to
+type RestrictedSpaceError struct {
+	SpaceID       string
+	Reason        string
+	Authenticated bool
+	// Ticketed is set for ticketed spaces, which can only be listened to by the ticket holders
+	Ticketed bool
+}
+
+func (e *RestrictedSpaceError) Error() string {
+	msg := "space " + e.SpaceID + " is restricted to " + e.Reason
+	if !e.Authenticated {
+		msg += ", login is required"
+	}
+	return msg
+}
+
+// Is matches ErrRestrictedSpace, ErrTicketedSpace for ticketed spaces, and ErrAuthRequired without a logged in session
+func (e *RestrictedSpaceError) Is(target error) bool {
+	switch target {
+	case ErrRestrictedSpace:
+		return true
+	case ErrTicketedSpace:
+		return e.Ticketed
+	case ErrAuthRequired:
+		return !e.Authenticated
+	}
+	return false
+}
+
+// IsCommunitySpace reports whether the space is hosted inside a Community
+func (r *AudioSpaceByIDResponse) IsCommunitySpace() bool {
+	return r.Data.AudioSpace.Metadata.CommunityResults.Result.RestId != ""
+}
+
+// IsTicketed reports whether the space is a ticketed space
+func (r *AudioSpaceByIDResponse) IsTicketed() bool {
+	metadata := r.Data.AudioSpace.Metadata
+	return metadata.TicketGroupId != "" || metadata.TicketsTotal > 0
+}
+
+// IsRestricted reports whether the audience of the space is limited, e.g. community, subscribers or employee only spaces
+func (r *AudioSpaceByIDResponse) IsRestricted() bool {
+	metadata := r.Data.AudioSpace.Metadata
+	return r.IsTicketed() || r.IsCommunitySpace() || metadata.NarrowCastSpaceType != NarrowCastSpaceTypePublic || metadata.IsEmployeeOnly
+}
+
+func (r *AudioSpaceByIDResponse) restrictionReason() string {
+	metadata := r.Data.AudioSpace.Metadata
+	switch {
+	case r.IsTicketed():
+		return "ticket holders"
+	case r.IsCommunitySpace():
+		if name := metadata.CommunityResults.Result.Name; name != "" {
+			return "members of the community " + name
+		}
+		return "community members"
+	case metadata.IsEmployeeOnly:
+		return "employees"
+	default:
+		return "subscribers"
+	}
+}
+
+// AccessErr is Err taking restrictions into account.
+// It returns a RestrictedSpaceError if the space is known to be inaccessible with the credentials.
+func (r *AudioSpaceByIDResponse) AccessErr(authenticated bool) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if !r.IsRestricted() {
+		return nil
+	}
+
+	metadata := r.Data.AudioSpace.Metadata
+	restricted := &RestrictedSpaceError{
+		SpaceID:       metadata.RestId,
+		Reason:        r.restrictionReason(),
+		Authenticated: authenticated,
+		Ticketed:      r.IsTicketed(),
+	}
+	switch {
+	case !authenticated:
+		return restricted
+	case r.IsTicketed() && !metadata.IsTicketHolder:
+		return restricted
+	case r.IsCommunitySpace() && metadata.CommunityResults.Result.Role == CommunityRoleNonMember:
+		return restricted
+	}
+	return nil
+}
+
+// CheckAccess reports whether the audio of the space can be accessed with the current credentials.
+// Restricted spaces are probed by requesting the stream.
+func (c *Client) CheckAccess(resp *AudioSpaceByIDResponse) error {
+	return c.CheckAccessContext(context.Background(), resp)
+}
+
+func (c *Client) CheckAccessContext(ctx context.Context, resp *AudioSpaceByIDResponse) error {
+	if err := resp.AccessErr(c.Authenticated()); err != nil {
+		return err
+	}
+	if !resp.IsRestricted() {
+		return nil
+	}
+
+	_, err := c.GetLiveVideoStreamContext(ctx, resp.Data.AudioSpace.Metadata.MediaKey)
+	var qe *QueryError
+	if errors.As(err, &qe) && (qe.StatusCode == http.StatusForbidden || qe.StatusCode == http.StatusUnauthorized) {
+		return &RestrictedSpaceError{
+			SpaceID:       resp.Data.AudioSpace.Metadata.RestId,
+			Reason:        resp.restrictionReason(),
+			Authenticated: c.Authenticated(),
+			Ticketed:      resp.IsTicketed(),
+		}
+	}
+	return err
+}
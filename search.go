@@ -0,0 +1,122 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	SearchFilterTop      = "top"
+	SearchFilterLive     = "live"
+	SearchFilterUpcoming = "upcoming"
+)
+
+type AudioSpaceSearchResponse struct {
+	Data struct {
+		SearchByRawQuery struct {
+			AudioSpacesGroupedBySection struct {
+				Sections []struct {
+					Name  string `json:"name"`
+					Items []struct {
+						Kind  string `json:"kind"`
+						Space struct {
+							RestId             string `json:"rest_id"`
+							State              string `json:"state"`
+							Title              string `json:"title"`
+							StartedAt          int64  `json:"started_at"`
+							ScheduledStart     int64  `json:"scheduled_start"`
+							TotalLiveListeners int    `json:"total_live_listeners"`
+						} `json:"space"`
+					} `json:"items"`
+				} `json:"sections"`
+			} `json:"audio_spaces_grouped_by_section"`
+		} `json:"search_by_raw_query"`
+	} `json:"data"`
+}
+
+// SearchedSpace is a space found by SearchSpaces
+type SearchedSpace struct {
+	SpaceID        string
+	Title          string
+	State          string
+	StartedAt      time.Time
+	ScheduledStart time.Time
+	Listeners      int
+}
+
+func AudioSpaceSearchParams(query, filter string) []QueryParameter {
+	return []QueryParameter{
+		{
+			Name: "variables",
+			Value: map[string]interface{}{
+				"rawQuery": query,
+				"filter":   filter,
+			},
+		},
+	}
+}
+
+// SearchSpaces finds spaces by keyword or hashtag, filter is one of SearchFilter*.
+func (c *Client) SearchSpaces(query, filter string) ([]SearchedSpace, error) {
+	return c.SearchSpacesContext(context.Background(), query, filter)
+}
+
+func (c *Client) SearchSpacesContext(ctx context.Context, query, filter string) ([]SearchedSpace, error) {
+	if query == "" {
+		return nil, errors.New("search query is empty")
+	}
+	if filter == "" {
+		filter = SearchFilterTop
+	}
+
+	var resp AudioSpaceSearchResponse
+	if err := c.QueryContext(ctx, "AudioSpaceSearch", AudioSpaceSearchParams(query, filter), &resp); err != nil {
+		return nil, err
+	}
+
+	// the same space may appear in several sections
+	seen := make(map[string]bool)
+	var spaces []SearchedSpace
+	for _, section := range resp.Data.SearchByRawQuery.AudioSpacesGroupedBySection.Sections {
+		for _, item := range section.Items {
+			s := item.Space
+			if s.RestId == "" || seen[s.RestId] {
+				continue
+			}
+			seen[s.RestId] = true
+
+			space := SearchedSpace{
+				SpaceID:   s.RestId,
+				Title:     s.Title,
+				State:     s.State,
+				Listeners: s.TotalLiveListeners,
+			}
+			if s.StartedAt > 0 {
+				space.StartedAt = time.UnixMilli(s.StartedAt)
+			}
+			if s.ScheduledStart > 0 {
+				space.ScheduledStart = time.UnixMilli(s.ScheduledStart)
+			}
+			spaces = append(spaces, space)
+		}
+	}
+
+	return spaces, nil
+}
@@ -0,0 +1,141 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package sidecar provides the formats of the files space-dl writes next to recordings.
+package sidecar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// SchemaVersion is the current version of the sidecar formats.
+// Files written before versioning was introduced have no schema field, and are read as version 1.
+const (
+	SchemaVersion = 2
+)
+
+const (
+	StatsFilename        = "stats.json"
+	ParticipantsFilename = "participants.json"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleSpeaker  = "speaker"
+	RoleListener = "listener"
+)
+
+type UnsupportedSchemaError struct {
+	File   string
+	Schema int
+}
+
+func (e *UnsupportedSchemaError) Error() string {
+	return fmt.Sprintf("%s: unsupported schema version %d (supported up to %d)", e.File, e.Schema, SchemaVersion)
+}
+
+type StatsSample struct {
+	Time          time.Time `json:"time"`
+	LiveListeners int       `json:"live_listeners"`
+	Participants  int       `json:"participants"`
+}
+
+type Stats struct {
+	Schema             int           `json:"schema"`
+	SpaceID            string        `json:"space_id"`
+	State              string        `json:"state"`
+	UpdatedAt          time.Time     `json:"updated_at"`
+	TotalLiveListeners int           `json:"total_live_listeners"`
+	TotalReplayWatched int           `json:"total_replay_watched"`
+	TakenDownAt        *time.Time    `json:"taken_down_at,omitempty"`
+	Samples            []StatsSample `json:"samples,omitempty"`
+}
+
+type Participant struct {
+	UserID          string     `json:"user_id"`
+	PeriscopeUserID string     `json:"periscope_user_id"`
+	ScreenName      string     `json:"screen_name"`
+	DisplayName     string     `json:"display_name"`
+	Roles           []string   `json:"roles"`
+	JoinedAt        *time.Time `json:"joined_at,omitempty"`
+	FirstSeen       time.Time  `json:"first_seen"`
+	LastSeen        time.Time  `json:"last_seen"`
+	FirstSpoke      *time.Time `json:"first_spoke,omitempty"`
+}
+
+type Participants struct {
+	Schema       int            `json:"schema"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	Total        int            `json:"total"`
+	Participants []*Participant `json:"participants"`
+}
+
+func ReadStats(file string) (*Stats, error) {
+	var stats Stats
+	if err := read(file, &stats, &stats.Schema); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func WriteStats(file string, stats *Stats) error {
+	stats.Schema = SchemaVersion
+	return write(file, stats)
+}
+
+func ReadParticipants(file string) (*Participants, error) {
+	var participants Participants
+	if err := read(file, &participants, &participants.Schema); err != nil {
+		return nil, err
+	}
+	return &participants, nil
+}
+
+func WriteParticipants(file string, participants *Participants) error {
+	participants.Schema = SchemaVersion
+	return write(file, participants)
+}
+
+func read(file string, v interface{}, schema *int) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+
+	if *schema == 0 {
+		*schema = 1
+	}
+	if *schema > SchemaVersion {
+		return &UnsupportedSchemaError{File: file, Schema: *schema}
+	}
+
+	return nil
+}
+
+func write(file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0666)
+}
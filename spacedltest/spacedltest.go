@@ -0,0 +1,129 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package spacedltest provides canned twitter responses of a space for testing without network access.
+//
+// The fixtures are synthetic and only contain the fields space-dl uses.
+package spacedltest
+
+import (
+	"embed"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	spacedl "github.com/qitoi/space-dl"
+)
+
+const (
+	SpaceID  = "1OdKrjkDEqjGX"
+	MediaKey = "28_1500000000000000000"
+	QueryID  = "fixtureAudioSpaceById"
+
+	// PlaylistURL is the replay playlist of the fixture space
+	PlaylistURL = "https://prod-fastly-ap-northeast-1.video.pscp.tv/Transcoding/v1/hls/fixture/non_transcode/ap-northeast-1/periscope-replay-direct-prod-ap-northeast-1-public/audio-space/playlist_16000000000000000000.m3u8"
+)
+
+var (
+	// Segments are the segment files of the playlist
+	Segments = []string{
+		"chunk_1640995260_0_a.aac",
+		"chunk_1640995263_1_a.aac",
+		"chunk_1640995266_2_a.aac",
+	}
+)
+
+//go:embed testdata
+var fixtures embed.FS
+
+// Cassette returns a replaying cassette of the fixture space. Query strings are ignored when matching requests.
+func Cassette() (*spacedl.Cassette, error) {
+	c := spacedl.NewReplayCassette(true)
+	jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+
+	files := []struct {
+		method string
+		url    string
+		file   string
+		header http.Header
+	}{
+		{"POST", "https://api.twitter.com/1.1/guest/activate.json", "guest_activate.json", jsonHeader},
+		{"GET", "https://api.twitter.com/graphql/" + QueryID + "/AudioSpaceById", "audiospace.json", jsonHeader},
+		{"GET", "https://twitter.com/i/api/graphql/" + QueryID + "/AudioSpaceById", "audiospace.json", jsonHeader},
+		{"GET", "https://twitter.com/i/api/1.1/live_video_stream/status/" + MediaKey, "live_video_stream.json", jsonHeader},
+		{"GET", PlaylistURL, "playlist.m3u8", http.Header{"Content-Type": []string{"application/vnd.apple.mpegurl"}}},
+	}
+	for _, f := range files {
+		body, err := fixtures.ReadFile(path.Join("testdata", f.file))
+		if err != nil {
+			return nil, err
+		}
+		c.AddResponse(f.method, f.url, http.StatusOK, f.header, body)
+	}
+
+	base, err := url.Parse(PlaylistURL)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range Segments {
+		u, err := base.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		c.AddResponse("GET", u.String(), http.StatusOK, http.Header{"Content-Type": []string{"audio/aac"}}, []byte(fmt.Sprintf("fixture segment %d", i)))
+	}
+
+	return c, nil
+}
+
+// NewClient returns an initialized Client replaying the fixture space, opts are applied after the fixture options.
+func NewClient(opts ...spacedl.ClientOption) (*spacedl.Client, error) {
+	cassette, err := Cassette()
+	if err != nil {
+		return nil, err
+	}
+
+	clientOpts := []spacedl.ClientOption{
+		spacedl.WithTransport(cassette),
+		spacedl.WithOperations([]*spacedl.Operation{
+			{
+				QueryID:       QueryID,
+				OperationName: "AudioSpaceById",
+				OperationType: "query",
+			},
+		}),
+	}
+	client, err := spacedl.NewClient(append(clientOpts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.InitializeOffline(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// HTTPClient returns a http.Client replaying the fixture playlist and segments, for Downloader.HTTPClient.
+func HTTPClient() (*http.Client, error) {
+	cassette, err := Cassette()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: cassette}, nil
+}
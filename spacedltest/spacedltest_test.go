@@ -0,0 +1,98 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedltest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	spacedl "github.com/qitoi/space-dl"
+	"github.com/qitoi/space-dl/spacedltest"
+)
+
+func TestFixtureSpace(t *testing.T) {
+	client, err := spacedltest.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	space, err := client.GetAudioSpace(spacedltest.SpaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := space.Err(); err != nil {
+		t.Fatalf("space error: %v", err)
+	}
+	metadata := space.Data.AudioSpace.Metadata
+	if metadata.RestId != spacedltest.SpaceID {
+		t.Errorf("rest id = %q, want %q", metadata.RestId, spacedltest.SpaceID)
+	}
+	if metadata.MediaKey != spacedltest.MediaKey {
+		t.Errorf("media key = %q, want %q", metadata.MediaKey, spacedltest.MediaKey)
+	}
+	if status := space.Status(); status != spacedl.SpaceStatusEnded {
+		t.Errorf("status = %v, want %v", status, spacedl.SpaceStatusEnded)
+	}
+
+	stream, err := client.GetLiveVideoStream(metadata.MediaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.Source.Location == "" {
+		t.Fatal("stream location is empty")
+	}
+
+	httpClient, err := spacedltest.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	dl := spacedl.NewDownloader(stream.Source.Location, dir)
+	dl.HTTPClient = httpClient
+	if err := dl.Download(); err != nil {
+		t.Fatal(err)
+	}
+	if missing := dl.Missing(); len(missing) != 0 {
+		t.Errorf("missing segments: %v", missing)
+	}
+
+	for i, name := range spacedltest.Segments {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("fixture segment %d", i); string(b) != want {
+			t.Errorf("%s = %q, want %q", name, b, want)
+		}
+	}
+}
+
+func TestFallbackOperations(t *testing.T) {
+	client, err := spacedltest.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the operation of the space itself is bundled
+	_, err = client.SearchSpaces("fixture", spacedl.SearchFilterTop)
+	if !errors.Is(err, spacedl.ErrOperationNotFound) {
+		t.Fatalf("err = %v, want %v", err, spacedl.ErrOperationNotFound)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	spaceIDLength = 13
+)
+
+var (
+	spaceIDRegexp       = regexp.MustCompile(`^1[a-zA-Z0-9]{12}$`)
+	spaceIDPrefixRegexp = regexp.MustCompile(`^1[a-zA-Z0-9]{12}`)
+)
+
+// ParseSpaceID extracts the space ID from a space ID or a space URL such as
+// https://twitter.com/i/spaces/<space_id>.
+func ParseSpaceID(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("space id is empty")
+	}
+
+	if strings.Contains(s, "/") {
+		return parseSpaceURL(s)
+	}
+
+	return validateSpaceID(s)
+}
+
+func parseSpaceURL(s string) (string, error) {
+	raw := s
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid space url %q: %v", raw, err)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "mobile.")
+	if host != "twitter.com" && host != "x.com" {
+		return "", fmt.Errorf("invalid space url %q: not a twitter.com or x.com link", raw)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "i" && parts[1] == "spaces":
+		id, err := validateSpaceID(parts[2])
+		if err != nil {
+			return "", fmt.Errorf("invalid space url %q: %w", raw, err)
+		}
+		return id, nil
+	case len(parts) >= 3 && parts[1] == "status":
+		return "", fmt.Errorf("invalid space url %q: this is a tweet link, copy the space link (https://twitter.com/i/spaces/...) from the tweet instead", raw)
+	case len(parts) >= 2 && parts[0] == "i" && parts[1] == "broadcasts":
+		return "", fmt.Errorf("invalid space url %q: this is a broadcast link, not a space link", raw)
+	case len(parts) == 1 && parts[0] != "":
+		return "", fmt.Errorf("invalid space url %q: this is a profile link, not a space link", raw)
+	}
+
+	return "", fmt.Errorf("invalid space url %q: expected https://twitter.com/i/spaces/<space_id>", raw)
+}
+
+func validateSpaceID(id string) (string, error) {
+	if spaceIDRegexp.MatchString(id) {
+		return id, nil
+	}
+
+	if i := strings.IndexAny(id, "?#&"); i >= 0 {
+		return "", fmt.Errorf("invalid space id %q: remove the query string %q", id, id[i:])
+	}
+
+	if prefix := spaceIDPrefixRegexp.FindString(id); prefix != "" {
+		return "", fmt.Errorf("invalid space id %q: unexpected trailing characters %q, did you mean %q?", id, id[len(prefix):], prefix)
+	}
+
+	if !strings.HasPrefix(id, "1") {
+		return "", fmt.Errorf("invalid space id %q: space id starts with \"1\"", id)
+	}
+
+	if len(id) != spaceIDLength {
+		return "", fmt.Errorf("invalid space id %q: space id is %d characters long, got %d", id, spaceIDLength, len(id))
+	}
+
+	return "", fmt.Errorf("invalid space id %q: space id consists of letters and digits", id)
+}
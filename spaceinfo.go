@@ -0,0 +1,150 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/qitoi/space-dl/sidecar"
+)
+
+// participant roles, shared with the sidecar formats
+const (
+	RoleAdmin    = sidecar.RoleAdmin
+	RoleSpeaker  = sidecar.RoleSpeaker
+	RoleListener = sidecar.RoleListener
+)
+
+// SpaceUser is a flattened User
+type SpaceUser struct {
+	UserID          string
+	PeriscopeUserID string
+	ScreenName      string
+	DisplayName     string
+	AvatarURL       string
+	Verified        bool
+}
+
+type SpaceParticipant struct {
+	SpaceUser
+	Role string
+}
+
+// SpaceInfo is a flattened AudioSpaceByIDResponse
+type SpaceInfo struct {
+	ID                 string
+	Title              string
+	Host               *SpaceUser
+	State              string
+	Status             SpaceStatus
+	IsScheduled        bool
+	ScheduledStart     time.Time
+	StartedAt          time.Time
+	EndedAt            time.Time
+	ReplayAvailable    bool
+	MediaKey           string
+	TotalLiveListeners int
+	TotalReplayWatched int
+	Participants       []SpaceParticipant
+	CommunityID        string
+	Restricted         bool
+	Ticketed           bool
+
+	// Raw is the response the info was built from
+	Raw *AudioSpaceByIDResponse
+}
+
+// NewSpaceInfo converts the response, time fields are zero if they are not set.
+func NewSpaceInfo(resp *AudioSpaceByIDResponse) *SpaceInfo {
+	metadata := resp.Data.AudioSpace.Metadata
+	info := &SpaceInfo{
+		ID:                 metadata.RestId,
+		Title:              metadata.Title,
+		State:              metadata.State,
+		Status:             resp.Status(),
+		IsScheduled:        resp.IsScheduled(),
+		ScheduledStart:     resp.ScheduledStart(),
+		StartedAt:          unixMilli(metadata.StartedAt),
+		ReplayAvailable:    metadata.IsSpaceAvailableForReplay,
+		MediaKey:           metadata.MediaKey,
+		TotalLiveListeners: metadata.TotalLiveListeners,
+		TotalReplayWatched: metadata.TotalReplayWatched,
+		CommunityID:        metadata.CommunityResults.Result.RestId,
+		Restricted:         resp.IsRestricted(),
+		Ticketed:           resp.IsTicketed(),
+		Raw:                resp,
+	}
+	if endedAt, err := strconv.ParseInt(metadata.EndedAt, 10, 64); err == nil {
+		info.EndedAt = unixMilli(endedAt)
+	}
+	if u := GetOwnerUser(resp); u != nil {
+		host := newSpaceUser(u)
+		info.Host = &host
+	}
+
+	participants := resp.Data.AudioSpace.Participants
+	for _, group := range []struct {
+		role  string
+		users []User
+	}{
+		{RoleAdmin, participants.Admins},
+		{RoleSpeaker, participants.Speakers},
+		{RoleListener, participants.Listeners},
+	} {
+		for i := range group.users {
+			info.Participants = append(info.Participants, SpaceParticipant{
+				SpaceUser: newSpaceUser(&group.users[i]),
+				Role:      group.role,
+			})
+		}
+	}
+
+	return info
+}
+
+func newSpaceUser(u *User) SpaceUser {
+	return SpaceUser{
+		UserID:          u.UserResults.RestId,
+		PeriscopeUserID: u.PeriscopeUserId,
+		ScreenName:      u.TwitterScreenName,
+		DisplayName:     u.DisplayName,
+		AvatarURL:       u.AvatarUrl,
+		Verified:        u.IsVerified || u.UserResults.Result.IsBlueVerified,
+	}
+}
+
+func unixMilli(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// GetSpaceInfo is GetAudioSpace returning SpaceInfo
+func (c *Client) GetSpaceInfo(spaceID string) (*SpaceInfo, error) {
+	return c.GetSpaceInfoContext(context.Background(), spaceID)
+}
+
+func (c *Client) GetSpaceInfoContext(ctx context.Context, spaceID string) (*SpaceInfo, error) {
+	resp, err := c.GetAudioSpaceContext(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	return NewSpaceInfo(resp), nil
+}
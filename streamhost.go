@@ -0,0 +1,144 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	streamHostCheckTimeout = 10 * time.Second
+)
+
+var (
+	// e.g. prod-fastly-ap-northeast-1.video.pscp.tv
+	streamHostRegexp   = regexp.MustCompile(`^prod-([a-z0-9]+)-([a-z]{2}-[a-z]+-[0-9])\.video\.pscp\.tv$`)
+	streamRegionRegexp = regexp.MustCompile(`/([a-z]{2}-[a-z]+-[0-9])/`)
+)
+
+// StreamLocation is the edge host serving the stream, CDN and Region are empty if they are unknown
+type StreamLocation struct {
+	Host   string
+	CDN    string
+	Region string
+}
+
+// ParseStreamLocation returns the location of the stream url
+func ParseStreamLocation(streamURL string) (StreamLocation, error) {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return StreamLocation{}, err
+	}
+	if u.Host == "" {
+		return StreamLocation{}, errors.New("stream url has no host")
+	}
+
+	loc := StreamLocation{Host: u.Host}
+	if m := streamHostRegexp.FindStringSubmatch(u.Hostname()); m != nil {
+		loc.CDN = m[1]
+		loc.Region = m[2]
+	} else if m := streamRegionRegexp.FindStringSubmatch(u.Path); m != nil {
+		loc.Region = m[1]
+	}
+	return loc, nil
+}
+
+// StreamLocation returns the location of Source.Location
+func (r *LiveVideoStreamResponse) StreamLocation() (StreamLocation, error) {
+	return ParseStreamLocation(r.Source.Location)
+}
+
+// WithStreamHosts makes the Client prefer the edge hosts for the streams, in the given order.
+// "{region}" in a host is replaced by the region of the stream, e.g. "prod-fastly-{region}.video.pscp.tv".
+// A host is used only if it serves the playlist, otherwise the host given by twitter is kept.
+// If pin is set, the first host is always used without checking it.
+func WithStreamHosts(hosts []string, pin bool) ClientOption {
+	return func(c *Client) {
+		c.streamHosts = hosts
+		c.pinStreamHost = pin
+	}
+}
+
+// selectStreamHost rewrites the host of the stream url to the preferred one
+func (c *Client) selectStreamHost(ctx context.Context, streamURL string) string {
+	if len(c.streamHosts) == 0 || streamURL == "" {
+		return streamURL
+	}
+
+	loc, err := ParseStreamLocation(streamURL)
+	if err != nil {
+		return streamURL
+	}
+
+	for _, host := range c.streamHosts {
+		if strings.Contains(host, "{region}") {
+			if loc.Region == "" {
+				continue
+			}
+			host = strings.ReplaceAll(host, "{region}", loc.Region)
+		}
+		if host == loc.Host {
+			return streamURL
+		}
+
+		u, _ := url.Parse(streamURL)
+		u.Host = host
+		candidate := u.String()
+		if c.pinStreamHost {
+			c.print("stream host: %s (pinned)", host)
+			return candidate
+		}
+		if err := c.checkStreamHost(ctx, candidate); err != nil {
+			c.print("stream host %s is not available: %v", host, err)
+			continue
+		}
+		c.print("stream host: %s", host)
+		return candidate
+	}
+
+	return streamURL
+}
+
+func (c *Client) checkStreamHost(ctx context.Context, streamURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, streamHostCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TokenCache is the state discovered by Initialize, saved to skip downloading twitter.com and the bundles
+type TokenCache struct {
+	MainJsURL   string `json:"main_js_url"`
+	ApiJsURL    string `json:"api_js_url"`
+	BearerToken string `json:"bearer_token"`
+	GuestToken  string `json:"guest_token"`
+	// GuestTokenAt is when the guest token was fetched, the guest token is replaced without renewing CreatedAt
+	GuestTokenAt time.Time             `json:"guest_token_at,omitempty"`
+	Operations   map[string]*Operation `json:"operations"`
+	Features     map[string]bool       `json:"features"`
+	// Endpoints are the urls the tokens were fetched from, the cache is not used with other endpoints
+	Endpoints Endpoints `json:"endpoints"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WithTokenCache makes Initialize load the tokens and operations from the file if it is newer than ttl,
+// and save them to the file after they are fetched.
+func WithTokenCache(file string, ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.tokenCacheFile = file
+		c.tokenCacheTTL = ttl
+	}
+}
+
+func (c *Client) loadTokenCache() error {
+	b, err := ioutil.ReadFile(c.tokenCacheFile)
+	if err != nil {
+		return err
+	}
+
+	var cache TokenCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return err
+	}
+	if c.clock.Now().Sub(cache.CreatedAt) > c.tokenCacheTTL {
+		return errors.New("token cache expired")
+	}
+	if cache.Endpoints != c.endpoints {
+		return errors.New("token cache of other endpoints")
+	}
+	if cache.BearerToken == "" || (len(cache.Operations) == 0 && len(c.operationOverrides) == 0) || (cache.GuestToken == "" && !c.Authenticated()) {
+		return errors.New("token cache incomplete")
+	}
+
+	c.mainJsURL = cache.MainJsURL
+	c.apiJsURL = cache.ApiJsURL
+	c.bearerToken = cache.BearerToken
+	if cache.GuestToken != "" {
+		fetchedAt := cache.GuestTokenAt
+		if fetchedAt.IsZero() {
+			fetchedAt = cache.CreatedAt
+		}
+		c.guestTokens.add(cache.GuestToken, fetchedAt)
+	}
+	c.operations = cache.Operations
+	c.featureValues = cache.Features
+	c.tokenCacheCreatedAt = cache.CreatedAt
+
+	return nil
+}
+
+// saveTokenCache writes the cache, CreatedAt is kept when only the guest token is replaced
+func (c *Client) saveTokenCache() error {
+	// the fallback is not cached so that the next run tries the bundles again
+	if c.tokenCacheFile == "" || c.fallbackErr != nil {
+		return nil
+	}
+
+	if c.tokenCacheCreatedAt.IsZero() {
+		c.tokenCacheCreatedAt = c.clock.Now()
+	}
+	token, _ := c.guestTokens.peekToken()
+
+	cache := TokenCache{
+		MainJsURL:    c.mainJsURL,
+		ApiJsURL:     c.apiJsURL,
+		BearerToken:  c.bearerToken,
+		GuestToken:   token.value,
+		GuestTokenAt: token.fetchedAt,
+		Operations:   c.operations,
+		Features:     c.featureValues,
+		Endpoints:    c.endpoints,
+		CreatedAt:    c.tokenCacheCreatedAt,
+	}
+	b, err := json.Marshal(&cache)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.tokenCacheFile), 0700); err != nil {
+		return err
+	}
+
+	// concurrent processes may share the cache, replace it atomically
+	f, err := ioutil.TempFile(filepath.Dir(c.tokenCacheFile), filepath.Base(c.tokenCacheFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), c.tokenCacheFile); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
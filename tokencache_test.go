@@ -0,0 +1,124 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock whose time is set by the test
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) NewTicker(d time.Duration) Ticker {
+	return SystemClock.NewTicker(d)
+}
+
+func (c *testClock) NewTimer(d time.Duration) Timer {
+	return SystemClock.NewTimer(d)
+}
+
+func TestTokenCacheTTL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	ttl := time.Hour
+	clock := &testClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	created := clock.now
+
+	newClient := func() *Client {
+		c, err := NewClient(WithTokenCache(file, ttl), WithClock(clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := newClient()
+	c.bearerToken = "bearer"
+	c.operations = fallbackOperations()
+	c.guestTokens.add("guest1", clock.now)
+	c.tokenCacheCreatedAt = clock.now
+	if err := c.saveTokenCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replacing the guest token keeps the age of the bearer token and the operations
+	clock.now = created.Add(50 * time.Minute)
+	c.guestTokens.remove("guest1")
+	c.guestTokens.add("guest2", clock.now)
+	if err := c.saveTokenCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache TokenCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.CreatedAt.Equal(created) {
+		t.Errorf("created at = %v, want %v", cache.CreatedAt, created)
+	}
+	if cache.GuestToken != "guest2" || !cache.GuestTokenAt.Equal(clock.now) {
+		t.Errorf("guest token = %q at %v, want %q at %v", cache.GuestToken, cache.GuestTokenAt, "guest2", clock.now)
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		valid   bool
+	}{
+		{"within ttl", 59 * time.Minute, true},
+		{"after ttl", 61 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = created.Add(tt.elapsed)
+			c := newClient()
+			err := c.loadTokenCache()
+			if tt.valid && err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expired cache was loaded")
+			}
+			if tt.valid && c.GuestToken() != "guest2" {
+				t.Errorf("guest token = %q, want %q", c.GuestToken(), "guest2")
+			}
+		})
+	}
+
+	// the cache of other endpoints is not used
+	clock.now = created
+	c, err = NewClient(WithTokenCache(file, ttl), WithClock(clock), WithEndpoints(XEndpoints))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.loadTokenCache(); err == nil {
+		t.Error("cache of other endpoints was loaded")
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"net/http"
+)
+
+// TransactionIDProvider generates the x-client-transaction-id header of twitter api requests.
+// The generation algorithm of the web client changes frequently, so it is left to the provider.
+type TransactionIDProvider interface {
+	TransactionID(method, path string) (string, error)
+}
+
+// TransactionIDFunc adapts a function to TransactionIDProvider
+type TransactionIDFunc func(method, path string) (string, error)
+
+func (f TransactionIDFunc) TransactionID(method, path string) (string, error) {
+	return f(method, path)
+}
+
+// WithTransactionIDProvider sets x-client-transaction-id of twitter api requests generated by the provider.
+func WithTransactionIDProvider(provider TransactionIDProvider) ClientOption {
+	return func(c *Client) {
+		c.transactionID = provider
+	}
+}
+
+func (c *Client) setTransactionID(req *http.Request) error {
+	if c.transactionID == nil || !c.isSessionHost(req.URL.Hostname()) {
+		return nil
+	}
+
+	id, err := c.transactionID.TransactionID(req.Method, req.URL.Path)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Client-Transaction-Id", id)
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	sharedTransportOnce sync.Once
+	sharedTransport     *http.Transport
+)
+
+// defaultTransport returns the transport shared by the Clients and Downloaders, so that connections are reused
+// between them. It is tuned for parallel segment downloads, http.DefaultTransport allows 2 idle connections per host.
+// If http.DefaultTransport was replaced, e.g. by a Cassette, it is used instead.
+func defaultTransport() http.RoundTripper {
+	dt, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return http.DefaultTransport
+	}
+
+	sharedTransportOnce.Do(func() {
+		t := dt.Clone()
+		t.ForceAttemptHTTP2 = true
+		t.MaxIdleConns = 100
+		t.MaxIdleConnsPerHost = 16
+		t.IdleConnTimeout = 90 * time.Second
+		t.TLSHandshakeTimeout = 10 * time.Second
+		t.ResponseHeaderTimeout = 30 * time.Second
+		t.ExpectContinueTimeout = 1 * time.Second
+		sharedTransport = t
+	})
+	return sharedTransport
+}
+
+// defaultHTTPClient returns an http.Client using the shared transport
+func defaultHTTPClient() *http.Client {
+	return &http.Client{Transport: defaultTransport()}
+}
@@ -0,0 +1,114 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type CreateTweetResponse struct {
+	Data struct {
+		CreateTweet struct {
+			TweetResults struct {
+				Result struct {
+					RestId string `json:"rest_id"`
+				} `json:"result"`
+			} `json:"tweet_results"`
+		} `json:"create_tweet"`
+	} `json:"data"`
+}
+
+func CreateTweetParams(text, replyTo string) []QueryParameter {
+	variables := map[string]interface{}{
+		"tweet_text":   text,
+		"dark_request": false,
+		"media": map[string]interface{}{
+			"media_entities":     []interface{}{},
+			"possibly_sensitive": false,
+		},
+		"semantic_annotation_ids": []interface{}{},
+	}
+	if replyTo != "" {
+		variables["reply"] = map[string]interface{}{
+			"in_reply_to_tweet_id":   replyTo,
+			"exclude_reply_user_ids": []interface{}{},
+		}
+	}
+	return []QueryParameter{
+		{
+			Name:  "variables",
+			Value: variables,
+		},
+	}
+}
+
+// CreateTweet posts a tweet from the logged in session, or a reply to the tweet replyTo if it is not empty,
+// and returns the id of the tweet. ErrAuthRequired is returned if the Client uses a guest token.
+// A request retried on a server error does not post the tweet twice, twitter rejects a duplicate of a recent tweet.
+func (c *Client) CreateTweet(text, replyTo string) (string, error) {
+	return c.CreateTweetContext(context.Background(), text, replyTo)
+}
+
+func (c *Client) CreateTweetContext(ctx context.Context, text, replyTo string) (string, error) {
+	if !c.Authenticated() {
+		return "", ErrAuthRequired
+	}
+
+	op, ok := c.operation("CreateTweet")
+	if !ok {
+		return "", &OperationNotFoundError{Name: "CreateTweet", Fallback: c.fallbackErr}
+	}
+
+	// mutations take the parameters in the json body
+	body := map[string]interface{}{
+		"queryId": op.QueryID,
+	}
+	for _, p := range c.withFeatures(op, CreateTweetParams(text, replyTo)) {
+		body[p.Name] = p.Value
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("%s/%s/%s", c.endpoints.GraphQL, op.QueryID, op.OperationName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.doAuthenticated(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out CreateTweetResponse
+	if err := parseResponse(resp, &out); err != nil {
+		return "", err
+	}
+	if out.Data.CreateTweet.TweetResults.Result.RestId == "" {
+		return "", errors.New("tweet was not created")
+	}
+	return out.Data.CreateTweet.TweetResults.Result.RestId, nil
+}
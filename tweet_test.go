@@ -0,0 +1,78 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateTweet(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/graphql/qid/CreateTweet" || r.Header.Get("X-Csrf-Token") != "csrf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"create_tweet":{"tweet_results":{"result":{"rest_id":"123"}}}}}`)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(
+		WithEndpoints(Endpoints{GraphQL: server.URL + "/graphql"}),
+		WithOperations([]*Operation{{QueryID: "qid", OperationName: "CreateTweet", OperationType: "mutation"}}),
+		WithSession("auth", "csrf"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.CreateTweet("hello", "456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "123" {
+		t.Errorf("id = %q, want 123", id)
+	}
+
+	if body["queryId"] != "qid" {
+		t.Errorf("queryId = %v, want qid", body["queryId"])
+	}
+	variables, _ := body["variables"].(map[string]interface{})
+	reply, _ := variables["reply"].(map[string]interface{})
+	if variables["tweet_text"] != "hello" || reply["in_reply_to_tweet_id"] != "456" {
+		t.Errorf("variables = %v", variables)
+	}
+}
+
+func TestCreateTweetGuest(t *testing.T) {
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateTweet("hello", ""); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("err = %v, want ErrAuthRequired", err)
+	}
+}
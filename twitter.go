@@ -17,15 +17,20 @@
 package spacedl
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/robertkrimen/otto/ast"
 	"github.com/robertkrimen/otto/parser"
@@ -33,25 +38,117 @@ import (
 
 const (
 	queryErrBadGuestToken = "Bad guest token"
+
+	maxBadGuestTokenRetries = 3
 )
 
-var (
-	mainJSRegexp    = regexp.MustCompile(`"(https://[^"]*?/main.[a-z0-9]+.js)"`)
-	apiSuffixRegexp = regexp.MustCompile(`api:"([a-z0-9]+)"`)
-	bearerRegexp    = regexp.MustCompile(`"(A{10,}[a-zA-Z0-9%]{30,})"`)
+const (
+	DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 )
 
 type Operation struct {
 	QueryID       string
 	OperationName string
 	OperationType string
+	// FeatureSwitches are the names of the feature flags the operation requires
+	FeatureSwitches []string
 }
 
 type Client struct {
 	client      *http.Client
 	operations  map[string]*Operation
+	mainJsURL   string
+	apiJsURL    string
 	bearerToken string
-	guestToken  string
+	fallbackErr error
+	guestTokens *guestTokenPool
+	userAgent   string
+	authToken   string
+	csrfToken   string
+	cookies     []*http.Cookie
+
+	rateLimits    *rateLimits
+	rateLimitWait time.Duration
+	retryPolicy   RetryPolicy
+
+	tokenCacheFile string
+	tokenCacheTTL  time.Duration
+	// tokenCacheCreatedAt is when the cached bearer token and operations were found
+	tokenCacheCreatedAt time.Time
+
+	operationOverrides map[string]*Operation
+
+	logger   *log.Logger
+	hooks    Hooks
+	proxies  *proxyPool
+	accounts *accountPool
+	headers  http.Header
+
+	transactionID TransactionIDProvider
+
+	featureValues    map[string]bool
+	featureOverrides map[string]bool
+
+	dump       io.Writer
+	clock      Clock
+	queryCache *queryCache
+
+	streamHosts   []string
+	pinStreamHost bool
+
+	endpoints Endpoints
+}
+
+type ClientOption func(*Client)
+
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithLogger makes the Client write diagnostic messages to the logger, nothing is written by default.
+func WithLogger(logger *log.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithHeader adds a header sent with every request, overriding the one set by the Client.
+// Cookie headers are sent in addition to the cookies of the Client.
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = make(http.Header)
+		}
+		c.headers.Add(key, value)
+	}
+}
+
+// WithSession makes the Client use an existing logged in session instead of a guest token.
+// authToken and ct0 are the values of the auth_token and ct0 cookies of the session.
+func WithSession(authToken, ct0 string) ClientOption {
+	return func(c *Client) {
+		c.authToken = authToken
+		c.csrfToken = ct0
+	}
+}
+
+// WithHTTPClient makes the Client send all requests with the given http.Client.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithTransport sets the RoundTripper used by the Client's http.Client.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		// copy so that the http.Client given by WithHTTPClient is not modified
+		client := *c.client
+		client.Transport = transport
+		c.client = &client
+	}
 }
 
 type QueryParameter struct {
@@ -132,15 +229,79 @@ type User struct {
 
 type Errors []struct {
 	Message   string `json:"message"`
+	Code      int    `json:"code"`
 	Locations []struct {
 		Line   int `json:"line"`
 		Column int `json:"column"`
 	} `json:"locations"`
 	Extensions struct {
 		Classification string `json:"classification"`
+		Kind           string `json:"kind"`
+		Code           int    `json:"code"`
 	} `json:"extensions"`
 }
 
+const (
+	SpaceStateNotStarted   = "NotStarted"
+	SpaceStatePrePublished = "PrePublished"
+	SpaceStateRunning      = "Running"
+	SpaceStateEnded        = "Ended"
+	SpaceStateTimedOut     = "TimedOut"
+	SpaceStateCanceled     = "Canceled"
+)
+
+// SpaceStatus is the typed state of a space
+type SpaceStatus int
+
+const (
+	SpaceStatusUnknown SpaceStatus = iota
+	SpaceStatusScheduled
+	SpaceStatusLive
+	SpaceStatusEnded
+	// SpaceStatusTimedOut is a space ended by twitter, e.g. after the host was disconnected
+	SpaceStatusTimedOut
+	SpaceStatusCanceled
+)
+
+func (s SpaceStatus) String() string {
+	switch s {
+	case SpaceStatusScheduled:
+		return "scheduled"
+	case SpaceStatusLive:
+		return "live"
+	case SpaceStatusEnded:
+		return "ended"
+	case SpaceStatusTimedOut:
+		return "timed out"
+	case SpaceStatusCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// IsFinal reports whether the space will not change its state anymore
+func (s SpaceStatus) IsFinal() bool {
+	return s == SpaceStatusEnded || s == SpaceStatusTimedOut || s == SpaceStatusCanceled
+}
+
+// ParseSpaceStatus converts the state string of the api, unrecognized states are SpaceStatusUnknown
+func ParseSpaceStatus(state string) SpaceStatus {
+	switch state {
+	case SpaceStateNotStarted, SpaceStatePrePublished:
+		return SpaceStatusScheduled
+	case SpaceStateRunning:
+		return SpaceStatusLive
+	case SpaceStateEnded:
+		return SpaceStatusEnded
+	case SpaceStateTimedOut:
+		return SpaceStatusTimedOut
+	case SpaceStateCanceled:
+		return SpaceStatusCanceled
+	}
+	return SpaceStatusUnknown
+}
+
 type AudioSpaceByIDResponse struct {
 	Data struct {
 		AudioSpace struct {
@@ -151,6 +312,7 @@ type AudioSpaceByIDResponse struct {
 				MediaKey                    string `json:"media_key"`
 				CreatedAt                   int64  `json:"created_at"`
 				StartedAt                   int64  `json:"started_at"`
+				ScheduledStart              int64  `json:"scheduled_start"`
 				EndedAt                     string `json:"ended_at"`
 				UpdatedAt                   int64  `json:"updated_at"`
 				DisallowJoin                bool   `json:"disallow_join"`
@@ -160,6 +322,10 @@ type AudioSpaceByIDResponse struct {
 				IsSpaceAvailableForReplay   bool   `json:"is_space_available_for_replay"`
 				IsSpaceAvailableForClipping bool   `json:"is_space_available_for_clipping"`
 				ConversationControls        int    `json:"conversation_controls"`
+				TicketGroupId               string `json:"ticket_group_id"`
+				TicketsSold                 int    `json:"tickets_sold"`
+				TicketsTotal                int    `json:"tickets_total"`
+				IsTicketHolder              bool   `json:"is_ticket_holder"`
 				TotalReplayWatched          int    `json:"total_replay_watched"`
 				TotalLiveListeners          int    `json:"total_live_listeners"`
 				CreatorResults              struct {
@@ -181,6 +347,14 @@ type AudioSpaceByIDResponse struct {
 						SuperFollowing      bool `json:"super_following"`
 					} `json:"result"`
 				} `json:"creator_results"`
+				CommunityResults struct {
+					Result struct {
+						Typename string `json:"__typename"`
+						RestId   string `json:"rest_id"`
+						Name     string `json:"name"`
+						Role     string `json:"role"`
+					} `json:"result"`
+				} `json:"community_results"`
 			} `json:"metadata"`
 			Sharings struct {
 				Items     []interface{} `json:"items"`
@@ -188,10 +362,10 @@ type AudioSpaceByIDResponse struct {
 				} `json:"slice_info"`
 			} `json:"sharings"`
 			Participants struct {
-				Total     int           `json:"total"`
-				Admins    []User        `json:"admins"`
-				Speakers  []interface{} `json:"speakers"`
-				Listeners []interface{} `json:"listeners"`
+				Total     int    `json:"total"`
+				Admins    []User `json:"admins"`
+				Speakers  []User `json:"speakers"`
+				Listeners []User `json:"listeners"`
 			} `json:"participants"`
 		} `json:"audioSpace"`
 	} `json:"data"`
@@ -221,14 +395,73 @@ func GetOwnerUser(resp *AudioSpaceByIDResponse) *User {
 	return nil
 }
 
-func NewClient() (*Client, error) {
+func NewClient(opts ...ClientOption) (*Client, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		client: &http.Client{Jar: jar},
-	}, nil
+	c := &Client{
+		client:      &http.Client{Jar: jar, Transport: defaultTransport()},
+		userAgent:   DefaultUserAgent,
+		guestTokens: newGuestTokenPool(),
+		endpoints:   DefaultEndpoints,
+		rateLimits:  newRateLimits(),
+		retryPolicy: DefaultRetryPolicy,
+		clock:       SystemClock,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.applyCookies()
+	if err := c.applyAccounts(); err != nil {
+		return nil, err
+	}
+	if err := c.applyProxies(); err != nil {
+		return nil, err
+	}
+	c.applyDebugDump()
+	return c, nil
+}
+
+// Authenticated reports whether the Client uses a logged in session.
+func (c *Client) Authenticated() bool {
+	return c.authToken != "" || c.accounts != nil
+}
+
+func (c *Client) UserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) MainJsURL() string {
+	return c.mainJsURL
+}
+
+func (c *Client) ApiJsURL() string {
+	return c.apiJsURL
+}
+
+func (c *Client) BearerToken() string {
+	return c.bearerToken
+}
+
+func (c *Client) GuestToken() string {
+	return c.guestTokens.peek()
+}
+
+func (c *Client) Operations() []*Operation {
+	operations := make([]*Operation, 0, len(c.operations)+len(c.operationOverrides))
+	for name, op := range c.operations {
+		if _, ok := c.operationOverrides[name]; !ok {
+			operations = append(operations, op)
+		}
+	}
+	for _, op := range c.operationOverrides {
+		operations = append(operations, op)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].OperationName < operations[j].OperationName
+	})
+	return operations
 }
 
 func replaceURLFile(u string, filename string) (string, error) {
@@ -242,51 +475,80 @@ func replaceURLFile(u string, filename string) (string, error) {
 }
 
 func (c *Client) Initialize() error {
-	index, err := c.getIndex()
-	if err != nil {
-		return err
+	return c.InitializeContext(context.Background())
+}
+
+func (c *Client) InitializeContext(ctx context.Context) error {
+	if c.tokenCacheFile != "" && c.loadTokenCache() == nil {
+		c.guestTokens.start()
+		return nil
+	}
+
+	scrapeErr := c.scrapeBundles(ctx)
+	if scrapeErr != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.print("warning: %v, using the fallback bearer token and operations", scrapeErr)
+		c.useFallback(scrapeErr)
+	}
+
+	if !c.Authenticated() {
+		if err := c.refreshGuestToken(ctx); err != nil {
+			return err
+		}
 	}
+	c.guestTokens.start()
+
+	// the fallback is not cached so that the next run tries the bundles again.
+	// the cache is only an optimization, failing to write it is not an error
+	if scrapeErr == nil {
+		c.tokenCacheCreatedAt = c.clock.Now()
+		_ = c.saveTokenCache()
+	}
+
+	return nil
+}
 
-	mainJsURL, err := c.getMainJsURL(index)
+// scrapeBundles finds the bearer token and the operations in the bundles of twitter.com
+func (c *Client) scrapeBundles(ctx context.Context) error {
+	index, err := c.getIndex(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("main js: %v\n", mainJsURL)
+	c.featureValues = extractFeatureValues(index)
 
-	apiJsURL, err := c.getApiJsURL(mainJsURL, index)
+	mainJsURL, err := c.findMainJsURL(ctx, index)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("api js: %v\n", apiJsURL)
+	c.print("main js: %v", mainJsURL)
+	c.mainJsURL = mainJsURL
 
-	operations, err := c.getOperations(apiJsURL)
+	mainJs, err := c.fetchBundle(ctx, mainJsURL)
 	if err != nil {
 		return err
 	}
-	c.operations = operations
+	chunks := chunkURLs(mainJsURL, index)
 
-	c.bearerToken, err = c.getBearerToken(mainJsURL)
+	c.bearerToken, err = c.findBearerToken(ctx, mainJs, chunks)
 	if err != nil {
 		return err
 	}
 
-	if err = c.refreshGuestToken(); err != nil {
+	operations, err := c.findOperations(ctx, mainJsURL, index, mainJs, chunks)
+	if err != nil {
 		return err
 	}
+	c.operations = operations
 
 	return nil
 }
 
-func (c *Client) getOperations(jsURL string) (map[string]*Operation, error) {
-	resp, err := c.get(jsURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	js, err := ioutil.ReadAll(resp.Body)
+func (c *Client) getOperations(ctx context.Context, jsURL string) (map[string]*Operation, error) {
+	js, err := c.fetchBundle(ctx, jsURL)
 	if err != nil {
 		return nil, err
 	}
@@ -299,54 +561,170 @@ func (c *Client) getOperations(jsURL string) (map[string]*Operation, error) {
 	return operations, nil
 }
 
-func (c *Client) refreshGuestToken() error {
-	token, err := getGuestToken(c.bearerToken)
+func (c *Client) GetStreamURL(mediaKey string) (string, error) {
+	return c.GetStreamURLContext(context.Background(), mediaKey)
+}
+
+func (c *Client) GetStreamURLContext(ctx context.Context, mediaKey string) (string, error) {
+	stream, err := c.GetLiveVideoStreamContext(ctx, mediaKey)
 	if err != nil {
-		return err
+		return "", err
 	}
-	c.guestToken = token
-	return nil
+	return stream.Source.Location, nil
 }
 
-func (c *Client) GetStreamURL(mediaKey string) (string, error) {
-	liveVideoStreamURL := fmt.Sprintf("https://twitter.com/i/api/1.1/live_video_stream/status/%s", mediaKey)
+func (c *Client) GetLiveVideoStream(mediaKey string) (*LiveVideoStreamResponse, error) {
+	return c.GetLiveVideoStreamContext(context.Background(), mediaKey)
+}
+
+func (c *Client) GetLiveVideoStreamContext(ctx context.Context, mediaKey string) (*LiveVideoStreamResponse, error) {
+	liveVideoStreamURL := c.endpoints.LiveVideoStream + "/" + mediaKey
 	params := make(url.Values)
 	params.Add("client", "web")
 	params.Add("use_syndication_guest_id", "false")
 	params.Add("cookie_set_host", "twitter.com")
 
-	resp, err := c.get(liveVideoStreamURL, &params)
+	resp, err := c.get(ctx, liveVideoStreamURL, &params)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
 	var obj LiveVideoStreamResponse
 	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
-		return "", err
+		return nil, err
 	}
+	obj.Source.Location = c.selectStreamHost(ctx, obj.Source.Location)
 
-	return obj.Source.Location, nil
+	return &obj, nil
 }
 
-func (c *Client) get(url string, query *url.Values) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func (c *Client) get(ctx context.Context, url string, query *url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.bearerToken)
-	req.Header.Set("X-Guest-Token", c.guestToken)
-
 	if query != nil {
 		req.URL.RawQuery = query.Encode()
 	}
 
-	return c.client.Do(req)
+	return c.doAuthenticated(ctx, req)
+}
+
+// doAuthenticated sends the request with the bearer token and the session or the guest token,
+// switching proxies and accounts and waiting for the rate limits.
+func (c *Client) doAuthenticated(ctx context.Context, req *http.Request) (*http.Response, error) {
+	// the bearer token is only sent to the twitter hosts and the configured endpoints
+	if c.isSessionHost(req.URL.Hostname()) {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	if c.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	// cookies set by the caller are kept, the session cookies are replaced on each attempt
+	cookie := req.Header.Get("Cookie")
+
+	endpoint := req.URL.Path
+	// proxies, accounts and rate limit waits have their own budgets, switching one does not use up the others
+	proxyRetries, accountRetries, waitRetries := 0, 0, 0
+	for retry := 0; ; retry++ {
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		account := c.setSession(req)
+		if cookie != "" {
+			if session := req.Header.Get("Cookie"); session != "" {
+				req.Header.Set("Cookie", cookie+"; "+session)
+			} else {
+				req.Header.Set("Cookie", cookie)
+			}
+		}
+		if err := c.waitRateLimit(ctx, endpoint); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && proxyRetries < c.proxies.size()-1 && c.proxies.rotateOnRateLimit() {
+			// the rate limit is per address, try again from the next proxy
+			c.print("rate limit exceeded: %s, switching proxy", endpoint)
+			proxyRetries += 1
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && accountRetries < c.accounts.size()-1 && c.accounts.rotateOnRateLimit() {
+			// the rate limit is per account, try again with the next account
+			c.print("rate limit exceeded: %s, switching account", endpoint)
+			accountRetries += 1
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode == http.StatusUnauthorized && account >= 0 && c.accounts.disable(account) {
+			// a disabled account is not used again, the attempts are bounded by the number of accounts
+			c.print("session of account #%d was rejected, switching account", account+1)
+			resp.Body.Close()
+			continue
+		}
+		c.rateLimits.update(endpoint, resp, c.clock.Now())
+		if resp.StatusCode != http.StatusTooManyRequests || waitRetries >= maxRateLimitRetries {
+			return resp, nil
+		}
+		waitRetries += 1
+		resp.Body.Close()
+	}
+}
+
+func (c *Client) setDefaultHeaders(req *http.Request) {
+	for key, values := range c.headers {
+		if key == "Cookie" {
+			// merged into a single header, requests may be sent again by retries
+			for _, v := range values {
+				cookie := req.Header.Get("Cookie")
+				if cookie == "" {
+					req.Header.Set("Cookie", v)
+				} else if !strings.Contains(cookie, v) {
+					req.Header.Set("Cookie", cookie+"; "+v)
+				}
+			}
+			continue
+		}
+		req.Header[key] = values
+	}
+}
+
+func (c *Client) print(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format+"\n", v...)
+	}
+}
+
+func isTwitterHost(host string) bool {
+	for _, domain := range []string{"twitter.com", "x.com"} {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
 }
 
-func (c *Client) getIndex() ([]byte, error) {
-	resp, err := c.get("https://twitter.com/", nil)
+func (c *Client) getIndex(ctx context.Context) ([]byte, error) {
+	resp, err := c.get(ctx, c.endpoints.Index, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -360,39 +738,96 @@ func (c *Client) getIndex() ([]byte, error) {
 	return index, nil
 }
 
-func (c *Client) getMainJsURL(index []byte) (string, error) {
-	matches := mainJSRegexp.FindSubmatch(index)
-	if len(matches) != 2 {
-		return "", errors.New("js url not found")
-	}
+func (r *AudioSpaceByIDResponse) Status() SpaceStatus {
+	return ParseSpaceStatus(r.Data.AudioSpace.Metadata.State)
+}
+
+// IsScheduled reports whether the space is scheduled and has not started yet
+func (r *AudioSpaceByIDResponse) IsScheduled() bool {
+	return r.Status() == SpaceStatusScheduled
+}
 
-	return string(matches[1]), nil
+// ScheduledStart returns the scheduled start time, or zero time if the space was not scheduled
+func (r *AudioSpaceByIDResponse) ScheduledStart() time.Time {
+	return unixMilli(r.Data.AudioSpace.Metadata.ScheduledStart)
 }
 
-func (c *Client) getApiJsURL(mainJsUrl string, index []byte) (string, error) {
-	apiMatches := apiSuffixRegexp.FindSubmatch(index)
-	if len(apiMatches) != 2 {
-		return "", errors.New("api suffix not found")
+// Err returns ErrSpaceNotFound, ErrSpaceNotStarted, ErrSpaceCanceled or ErrSpaceEnded if the space cannot be downloaded,
+// or nil if it is running or its replay is available.
+func (r *AudioSpaceByIDResponse) Err() error {
+	metadata := r.Data.AudioSpace.Metadata
+	if metadata.RestId == "" {
+		return ErrSpaceNotFound
+	}
+	switch r.Status() {
+	case SpaceStatusLive:
+		return nil
+	case SpaceStatusScheduled:
+		return ErrSpaceNotStarted
+	case SpaceStatusCanceled:
+		return ErrSpaceCanceled
+	case SpaceStatusEnded, SpaceStatusTimedOut:
+		if metadata.IsSpaceAvailableForReplay {
+			return nil
+		}
 	}
+	return ErrSpaceEnded
+}
 
-	apiFileName := "api." + string(apiMatches[1]) + "a.js"
+func AudioSpaceByIDParams(spaceID string) []QueryParameter {
+	var params []QueryParameter
 
-	apiJsUrl, err := replaceURLFile(mainJsUrl, apiFileName)
-	if err != nil {
-		return "", err
+	variables := AudioSpaceByIDVariables{
+		ID: spaceID,
 	}
+	v, _ := json.Marshal(variables)
+	var vv map[string]interface{}
+	json.Unmarshal(v, &vv)
+	params = append(params, QueryParameter{
+		Name:  "variables",
+		Value: vv,
+	})
+
+	features := AudioSpaceByIDFeatures{}
+	f, _ := json.Marshal(features)
+	var ff map[string]interface{}
+	json.Unmarshal(f, &ff)
+	params = append(params, QueryParameter{
+		Name:  "features",
+		Value: ff,
+	})
+
+	return params
+}
+
+func (c *Client) GetAudioSpace(spaceID string) (*AudioSpaceByIDResponse, error) {
+	return c.GetAudioSpaceContext(context.Background(), spaceID)
+}
 
-	return apiJsUrl, nil
+func (c *Client) GetAudioSpaceContext(ctx context.Context, spaceID string) (*AudioSpaceByIDResponse, error) {
+	var resp AudioSpaceByIDResponse
+	if err := c.QueryContext(ctx, "AudioSpaceById", AudioSpaceByIDParams(spaceID), &resp); err != nil {
+		return nil, err
+	}
+	// deleted spaces are returned without metadata
+	if resp.Data.AudioSpace.Metadata.RestId == "" {
+		return nil, ErrSpaceNotFound
+	}
+	return &resp, nil
 }
 
 func (c *Client) Query(name string, params []QueryParameter, out interface{}) error {
-	op, ok := c.operations[name]
+	return c.QueryContext(context.Background(), name, params, out)
+}
+
+func (c *Client) QueryContext(ctx context.Context, name string, params []QueryParameter, out interface{}) error {
+	op, ok := c.operation(name)
 	if !ok {
-		return fmt.Errorf("operation not found: %v", name)
+		return &OperationNotFoundError{Name: name, Fallback: c.fallbackErr}
 	}
 
 	query := make(url.Values)
-	for _, v := range params {
+	for _, v := range c.withFeatures(op, params) {
 		s, err := json.Marshal(v.Value)
 		if err != nil {
 			return err
@@ -400,26 +835,65 @@ func (c *Client) Query(name string, params []QueryParameter, out interface{}) er
 		query.Add(v.Name, string(s))
 	}
 
-	u := fmt.Sprintf("https://api.twitter.com/graphql/%s/%s", op.QueryID, op.OperationName)
-	resp, err := c.get(u, &query)
-	if err != nil {
+	u := fmt.Sprintf("%s/%s/%s", c.endpoints.GuestGraphQL, op.QueryID, op.OperationName)
+	if c.Authenticated() {
+		u = fmt.Sprintf("%s/%s/%s", c.endpoints.GraphQL, op.QueryID, op.OperationName)
+	}
+
+	cacheKey := u + "?" + query.Encode()
+	cached := c.queryCache.enabled(name)
+	if cached {
+		if body, ok := c.queryCache.get(cacheKey, c.clock.Now()); ok {
+			return parseCachedResponse(body, out)
+		}
+	}
+
+	for retry := 0; ; retry++ {
+		resp, err := c.get(ctx, u, &query)
+		if err != nil {
+			return err
+		}
+
+		var body []byte
+		if cached && resp.StatusCode == http.StatusOK {
+			body, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		err = parseResponse(resp, out)
+		resp.Body.Close()
+		if err == nil && body != nil {
+			c.queryCache.put(cacheKey, body, c.clock.Now())
+		}
+		if !c.Authenticated() && retry < maxBadGuestTokenRetries && isBadGuestToken(err) {
+			var token string
+			if resp.Request != nil {
+				token = resp.Request.Header.Get("X-Guest-Token")
+			}
+			if err := c.discardGuestToken(ctx, token); err != nil {
+				return err
+			}
+			_ = c.saveTokenCache()
+			continue
+		}
+
 		return err
 	}
-	defer resp.Body.Close()
+}
 
-	err = parseResponse(resp, out)
+func isBadGuestToken(err error) bool {
 	if qe, ok := err.(*QueryError); ok {
 		for _, e := range qe.Errors {
 			if strings.EqualFold(e.Message, queryErrBadGuestToken) {
-				if err := c.refreshGuestToken(); err != nil {
-					return err
-				}
-				return c.Query(name, params, out)
+				return true
 			}
 		}
 	}
-
-	return err
+	return false
 }
 
 func parseResponse(resp *http.Response, out interface{}) error {
@@ -462,25 +936,6 @@ func parseResponse(resp *http.Response, out interface{}) error {
 	return nil
 }
 
-func (c *Client) getBearerToken(jsURL string) (string, error) {
-	resp, err := c.get(jsURL, nil)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	js, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	matches := bearerRegexp.FindStringSubmatch(string(js))
-	if len(matches) != 2 {
-		return "", errors.New("bearer token not found")
-	}
-	return matches[1], nil
-}
-
 func extractOperations(src string) map[string]*Operation {
 	operations := make(map[string]*Operation)
 
@@ -514,6 +969,9 @@ func extractOperations(src string) map[string]*Operation {
 			if stmt, ok := b.(*ast.ExpressionStatement); ok {
 				if literal, ok := stmt.Expression.(*ast.ObjectLiteral); ok {
 					for _, prop := range literal.Value {
+						if metadata, ok := prop.Value.(*ast.ObjectLiteral); ok && prop.Key == "metadata" {
+							op.FeatureSwitches = extractFeatureSwitches(metadata)
+						}
 						if value, ok := prop.Value.(*ast.StringLiteral); ok {
 							switch prop.Key {
 							case "queryId":
@@ -539,15 +997,32 @@ func extractOperations(src string) map[string]*Operation {
 	return operations
 }
 
-func getGuestToken(bearerToken string) (string, error) {
-	req, err := http.NewRequest("post", "https://api.twitter.com/1.1/guest/activate.json", nil)
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
+// extractFeatureSwitches returns featureSwitches of the metadata, {featureSwitches:["a","b"]}
+func extractFeatureSwitches(metadata *ast.ObjectLiteral) []string {
+	var switches []string
+	for _, prop := range metadata.Value {
+		if array, ok := prop.Value.(*ast.ArrayLiteral); ok && prop.Key == "featureSwitches" {
+			for _, v := range array.Value {
+				if name, ok := v.(*ast.StringLiteral); ok {
+					switches = append(switches, name.Value)
+				}
+			}
+		}
+	}
+	return switches
+}
+
+func (c *Client) getGuestToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "post", c.endpoints.GuestActivate, nil)
 	if err != nil {
 		return "", err
 	}
+	req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -557,10 +1032,20 @@ func getGuestToken(bearerToken string) (string, error) {
 		GuestToken string `json:"guest_token"`
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return "", &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
 	var response GuestActivateResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return "", err
 	}
+	if response.GuestToken == "" {
+		return "", errors.New("guest token not found")
+	}
 
 	return response.GuestToken, nil
 }
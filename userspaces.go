@@ -0,0 +1,187 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// user_ids of avatar_content accepts up to 100 ids
+	avatarContentMaxUsers = 100
+)
+
+type AvatarContentResponse struct {
+	Users map[string]struct {
+		Spaces struct {
+			LiveContent struct {
+				AudioSpace *AvatarAudioSpace `json:"audiospace"`
+			} `json:"live_content"`
+		} `json:"spaces"`
+	} `json:"users"`
+}
+
+type AvatarAudioSpace struct {
+	BroadcastID          string `json:"broadcast_id"`
+	Title                string `json:"title"`
+	State                string `json:"state"`
+	Start                int64  `json:"start"`
+	ScheduledStart       int64  `json:"scheduled_start"`
+	CreatorTwitterUserID int64  `json:"creator_twitter_user_id"`
+}
+
+// UserSpace is a live or scheduled space of a user
+type UserSpace struct {
+	UserID         string
+	SpaceID        string
+	Title          string
+	State          string
+	StartedAt      time.Time
+	ScheduledStart time.Time
+}
+
+func (s *UserSpace) IsLive() bool {
+	return ParseSpaceStatus(s.State) == SpaceStatusLive
+}
+
+func (s *UserSpace) IsScheduled() bool {
+	return ParseSpaceStatus(s.State) == SpaceStatusScheduled
+}
+
+type UserByScreenNameResponse struct {
+	Data struct {
+		User struct {
+			Result struct {
+				RestId string `json:"rest_id"`
+			} `json:"result"`
+		} `json:"user"`
+	} `json:"data"`
+}
+
+func UserByScreenNameParams(screenName string) []QueryParameter {
+	return []QueryParameter{
+		{
+			Name: "variables",
+			Value: map[string]interface{}{
+				"screen_name":              strings.TrimPrefix(screenName, "@"),
+				"withSafetyModeUserFields": true,
+			},
+		},
+	}
+}
+
+// GetUserID returns the numeric rest id of the user, for GetUserSpaces.
+// The UserByScreenName operation is not bundled, so it fails with ErrOperationNotFound while the client uses the fallback.
+func (c *Client) GetUserID(screenName string) (string, error) {
+	return c.GetUserIDContext(context.Background(), screenName)
+}
+
+func (c *Client) GetUserIDContext(ctx context.Context, screenName string) (string, error) {
+	var resp UserByScreenNameResponse
+	if err := c.QueryContext(ctx, "UserByScreenName", UserByScreenNameParams(screenName), &resp); err != nil {
+		return "", err
+	}
+	// unknown users are returned without result
+	if resp.Data.User.Result.RestId == "" {
+		return "", ErrNotFound
+	}
+	return resp.Data.User.Result.RestId, nil
+}
+
+// GetUserSpaces returns the live or scheduled spaces hosted by the users, userIDs are the numeric rest ids.
+func (c *Client) GetUserSpaces(userIDs []string) ([]UserSpace, error) {
+	return c.GetUserSpacesContext(context.Background(), userIDs)
+}
+
+func (c *Client) GetUserSpacesContext(ctx context.Context, userIDs []string) ([]UserSpace, error) {
+	if len(userIDs) == 0 {
+		return nil, errors.New("no user ids")
+	}
+
+	var spaces []UserSpace
+	for len(userIDs) > 0 {
+		n := len(userIDs)
+		if n > avatarContentMaxUsers {
+			n = avatarContentMaxUsers
+		}
+		s, err := c.getAvatarContent(ctx, userIDs[:n])
+		if err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, s...)
+		userIDs = userIDs[n:]
+	}
+
+	return spaces, nil
+}
+
+func (c *Client) getAvatarContent(ctx context.Context, userIDs []string) ([]UserSpace, error) {
+	params := make(url.Values)
+	params.Add("user_ids", strings.Join(userIDs, ","))
+	params.Add("only_spaces", "true")
+
+	resp, err := c.get(ctx, c.endpoints.AvatarContent, &params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &QueryError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	var obj AvatarContentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	var spaces []UserSpace
+	for userID, u := range obj.Users {
+		s := u.Spaces.LiveContent.AudioSpace
+		if s == nil || s.BroadcastID == "" {
+			continue
+		}
+		space := UserSpace{
+			UserID:  userID,
+			SpaceID: s.BroadcastID,
+			Title:   s.Title,
+			State:   s.State,
+		}
+		if s.Start > 0 {
+			space.StartedAt = time.UnixMilli(s.Start)
+		}
+		if s.ScheduledStart > 0 {
+			space.ScheduledStart = time.UnixMilli(s.ScheduledStart)
+		}
+		spaces = append(spaces, space)
+	}
+	sort.Slice(spaces, func(i, j int) bool {
+		return spaces[i].UserID < spaces[j].UserID
+	})
+
+	return spaces, nil
+}
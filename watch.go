@@ -0,0 +1,132 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SpaceSnapshot is a state of a space observed by WatchSpace
+type SpaceSnapshot struct {
+	Time time.Time
+	// Info is nil if Err is set or the space was taken down
+	Info *SpaceInfo
+	Err  error
+	// TakenDown is set when the space was deleted or the host account was suspended
+	TakenDown bool
+	// Ended is set on the last snapshot before the channel is closed, when the space ended, timed out or was canceled
+	Ended        bool
+	StateChanged bool
+	Joined       []SpaceParticipant
+	Left         []SpaceParticipant
+}
+
+// WithClock sets the clock used by the polling loops of the Client
+func WithClock(clock Clock) ClientOption {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WatchSpace polls the space at the interval and sends the snapshots until the space ends or ctx is done,
+// then the channel is closed.
+func (c *Client) WatchSpace(ctx context.Context, spaceID string, interval time.Duration) <-chan SpaceSnapshot {
+	return c.WatchSpaceFunc(ctx, interval, func(ctx context.Context) (*AudioSpaceByIDResponse, error) {
+		return c.GetAudioSpaceContext(ctx, spaceID)
+	})
+}
+
+// WatchSpaceFunc is WatchSpace fetching the space with fetch, for callers customizing the query.
+func (c *Client) WatchSpaceFunc(ctx context.Context, interval time.Duration, fetch func(ctx context.Context) (*AudioSpaceByIDResponse, error)) <-chan SpaceSnapshot {
+	ch := make(chan SpaceSnapshot, 1)
+
+	go func() {
+		defer close(ch)
+
+		ticker := c.clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		var prev *SpaceInfo
+		for {
+			snapshot := SpaceSnapshot{
+				Time: c.clock.Now(),
+			}
+			resp, err := fetch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case errors.Is(err, ErrNotFound) || errors.Is(err, ErrSuspended):
+				snapshot.TakenDown = true
+			case err != nil:
+				snapshot.Err = err
+			case resp.Data.AudioSpace.Metadata.RestId == "":
+				// deleted spaces are returned without metadata
+				snapshot.TakenDown = true
+			default:
+				info := NewSpaceInfo(resp)
+				snapshot.Info = info
+				snapshot.Ended = info.Status.IsFinal()
+				if prev != nil {
+					snapshot.StateChanged = prev.State != info.State
+					snapshot.Joined = diffParticipants(info.Participants, prev.Participants)
+					snapshot.Left = diffParticipants(prev.Participants, info.Participants)
+				}
+				prev = info
+			}
+
+			select {
+			case ch <- snapshot:
+			case <-ctx.Done():
+				return
+			}
+			if snapshot.Ended {
+				return
+			}
+
+			select {
+			case <-ticker.C():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// diffParticipants returns the participants of a not in b, a role change counts as a new participant
+func diffParticipants(a, b []SpaceParticipant) []SpaceParticipant {
+	type key struct {
+		id   string
+		role string
+	}
+	exists := make(map[key]bool, len(b))
+	for _, p := range b {
+		exists[key{p.PeriscopeUserID, p.Role}] = true
+	}
+
+	var diff []SpaceParticipant
+	for _, p := range a {
+		if !exists[key{p.PeriscopeUserID, p.Role}] {
+			diff = append(diff, p)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,239 @@
+/*
+ *  Copyright 2021 qitoi
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package spacedl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// fakeConn reads the frames sent by the server, and keeps the frames written by the client
+type fakeConn struct {
+	r io.Reader
+	w bytes.Buffer
+}
+
+func (c *fakeConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *fakeConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c *fakeConn) Close() error                { return nil }
+
+func newTestWsConn(in []byte) (*wsConn, *fakeConn) {
+	conn := &fakeConn{r: bytes.NewReader(in)}
+	return &wsConn{rwc: conn, br: bufio.NewReader(conn)}, conn
+}
+
+// encodeFrame encodes a frame as sent by a server, masked if mask is given
+func encodeFrame(fin bool, opcode byte, payload []byte, mask []byte) []byte {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	var maskBit byte
+	if mask != nil {
+		maskBit = 0x80
+	}
+
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		frame = append(append(frame, maskBit|127), b[:]...)
+	}
+
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+func TestWsWriteFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		lenByte byte
+		header  int
+	}{
+		{"empty", 0, 0, 2},
+		{"7 bit length", 125, 125, 2},
+		{"16 bit length", 126, 126, 4},
+		{"16 bit length max", 0xffff, 126, 4},
+		{"64 bit length", 0x10000, 127, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := bytes.Repeat([]byte("a"), tt.size)
+
+			ws, conn := newTestWsConn(nil)
+			if err := ws.writeFrame(wsOpText, payload); err != nil {
+				t.Fatal(err)
+			}
+			raw := conn.w.Bytes()
+
+			if raw[0] != 0x80|wsOpText {
+				t.Errorf("first byte = %#x, want fin and text", raw[0])
+			}
+			if raw[1]&0x80 == 0 {
+				t.Error("client frame is not masked")
+			}
+			if raw[1]&0x7f != tt.lenByte {
+				t.Errorf("length byte = %d, want %d", raw[1]&0x7f, tt.lenByte)
+			}
+			if len(raw) != tt.header+4+tt.size {
+				t.Errorf("frame size = %d, want %d", len(raw), tt.header+4+tt.size)
+			}
+
+			// the frame is decoded back with its mask
+			reader, _ := newTestWsConn(raw)
+			fin, opcode, got, err := reader.readFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !fin || opcode != wsOpText || !bytes.Equal(got, payload) {
+				t.Errorf("decoded fin=%v opcode=%d payload size=%d", fin, opcode, len(got))
+			}
+		})
+	}
+}
+
+func TestWsReadMessage(t *testing.T) {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	tests := []struct {
+		name    string
+		in      [][]byte
+		want    string
+		wantErr error
+		// frames answered by the client
+		replies []byte
+	}{
+		{
+			name: "text",
+			in:   [][]byte{encodeFrame(true, wsOpText, []byte("hello"), nil)},
+			want: "hello",
+		},
+		{
+			name: "masked",
+			in:   [][]byte{encodeFrame(true, wsOpText, []byte("hello"), mask)},
+			want: "hello",
+		},
+		{
+			name: "16 bit length",
+			in:   [][]byte{encodeFrame(true, wsOpBinary, bytes.Repeat([]byte("b"), 300), nil)},
+			want: string(bytes.Repeat([]byte("b"), 300)),
+		},
+		{
+			name: "fragmented",
+			in: [][]byte{
+				encodeFrame(false, wsOpText, []byte("hel"), nil),
+				encodeFrame(false, wsOpContinuation, []byte("lo "), nil),
+				encodeFrame(true, wsOpContinuation, []byte("world"), mask),
+			},
+			want: "hello world",
+		},
+		{
+			name: "ping between fragments",
+			in: [][]byte{
+				encodeFrame(false, wsOpText, []byte("hel"), nil),
+				encodeFrame(true, wsOpPing, []byte("ping"), nil),
+				encodeFrame(true, wsOpPong, nil, nil),
+				encodeFrame(true, wsOpContinuation, []byte("lo"), nil),
+			},
+			want:    "hello",
+			replies: []byte{wsOpPong},
+		},
+		{
+			name:    "close",
+			in:      [][]byte{encodeFrame(true, wsOpClose, []byte{0x03, 0xe8}, nil)},
+			wantErr: io.EOF,
+			replies: []byte{wsOpClose},
+		},
+		{
+			name:    "closed connection",
+			in:      nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "truncated",
+			in:      [][]byte{encodeFrame(true, wsOpText, []byte("hello"), nil)[:4]},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "unknown opcode",
+			in:   [][]byte{encodeFrame(true, 0x3, []byte("x"), nil)},
+		},
+		{
+			name: "too large",
+			in:   [][]byte{{0x80 | wsOpText, 127, 0, 0, 0, 0, 0x10, 0, 0, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, conn := newTestWsConn(bytes.Join(tt.in, nil))
+
+			got, err := ws.readMessage()
+			switch {
+			case tt.want != "":
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("message = %q, want %q", got, tt.want)
+				}
+			case tt.wantErr != nil:
+				if err != tt.wantErr {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil {
+					t.Errorf("message = %q, want error", got)
+				}
+			}
+
+			// the pong echoes the ping and the close echoes the status code
+			replies, _ := newTestWsConn(conn.w.Bytes())
+			for _, op := range tt.replies {
+				fin, opcode, payload, err := replies.readFrame()
+				if err != nil {
+					t.Fatalf("reply: %v", err)
+				}
+				if !fin || opcode != op {
+					t.Errorf("reply opcode = %d, want %d", opcode, op)
+				}
+				if op == wsOpPong && string(payload) != "ping" {
+					t.Errorf("pong payload = %q, want ping", payload)
+				}
+				if op == wsOpClose && !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+					t.Errorf("close payload = %v, want 1000", payload)
+				}
+			}
+			if _, _, _, err := replies.readFrame(); err != io.EOF {
+				t.Errorf("unexpected reply, err = %v", err)
+			}
+		})
+	}
+}